@@ -0,0 +1,171 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+	"unicode/utf8"
+)
+
+// --- Analytics ---
+
+// analyticsHashKey keys the email hashes in the analytics dataset. Hashes are
+// stable across dumps (so BI joins work) but can't be reversed by hashing a
+// list of known addresses without the key. Without one the dataset isn't served,
+// since unkeyed hashes of email addresses are trivially reversed.
+var analyticsHashKey = []byte(os.Getenv("ANALYTICS_HASH_KEY"))
+
+// AnonymizedRequest is the PII-free view of a Request exported to BI tools.
+type AnonymizedRequest struct {
+	ID                int       `json:"id"`
+	ClientEmailHash   string    `json:"client_email_hash"`
+	SupplierEmailHash string    `json:"supplier_email_hash"`
+	DetailsLength     int       `json:"details_length"`
+	CreatedAt         time.Time `json:"created_at"` // truncated to the hour
+}
+
+// hashEmail returns a keyed SHA-256 of an email address, hex encoded.
+func hashEmail(email string) string {
+	mac := hmac.New(sha256.New, analyticsHashKey)
+	mac.Write([]byte(email))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// anonymizeRequest strips free text and hashes identities. Client names, gig
+// titles and details can all contain PII, so only their shape survives. Email
+// domains are left out too: a small business's own domain identifies its client.
+func anonymizeRequest(req Request) AnonymizedRequest {
+	return AnonymizedRequest{
+		ID:                req.ID,
+		ClientEmailHash:   hashEmail(req.ClientEmail),
+		SupplierEmailHash: hashEmail(req.SupplierEmail),
+		DetailsLength:     utf8.RuneCountInString(req.Details),
+		CreatedAt:         req.CreatedAt.UTC().Truncate(time.Hour),
+	}
+}
+
+// AnalyticsDatasetHandler handles GET /admin/analytics/dataset.
+func AnalyticsDatasetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if len(analyticsHashKey) == 0 {
+		writeError(w, r, http.StatusServiceUnavailable, "Analytics dataset is disabled: ANALYTICS_HASH_KEY is not set")
+		return
+	}
+
+	all, _, err := store.List(r.Context(), ListFilter{})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error listing requests", "err", err)
+		writeError(w, r, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	dataset := make([]AnonymizedRequest, 0, len(all))
+	for _, req := range all {
+		dataset = append(dataset, anonymizeRequest(req))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(dataset); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding response", "err", err)
+	}
+}
+
+// defaultHeatmapRange is how far back the heatmap looks when no "from" is given.
+const defaultHeatmapRange = 30 * 24 * time.Hour
+
+// Heatmap is the payload returned by GET /admin/analytics/heatmap.
+// Counts is indexed [weekday][hour], with weekday 0 = Sunday as in time.Weekday.
+type Heatmap struct {
+	From     time.Time  `json:"from"`
+	To       time.Time  `json:"to"`
+	Timezone string     `json:"timezone"`
+	Days     []string   `json:"days"`
+	Counts   [7][24]int `json:"counts"`
+}
+
+// AnalyticsHeatmapHandler handles GET /admin/analytics/heatmap?from=&to=&tz=,
+// counting request creations by day of week and hour of day.
+func AnalyticsHeatmapHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	query := r.URL.Query()
+
+	// 1. Resolve the date range (RFC3339), defaulting to the last 30 days
+	to := time.Now().UTC()
+	if v := query.Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			invalidParam(w, r, "to", "must be RFC3339")
+			return
+		}
+		to = t
+	}
+
+	from := to.Add(-defaultHeatmapRange)
+	if v := query.Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			invalidParam(w, r, "from", "must be RFC3339")
+			return
+		}
+		from = t
+	}
+
+	if !from.Before(to) {
+		writeError(w, r, http.StatusBadRequest, "'from' must be before 'to'")
+		return
+	}
+
+	// 2. Bucket in the requested timezone so hours line up with local traffic
+	loc := time.UTC
+	if v := query.Get("tz"); v != "" {
+		l, err := time.LoadLocation(v)
+		if err != nil {
+			invalidParam(w, r, "tz", "unknown timezone")
+			return
+		}
+		loc = l
+	}
+
+	heatmap := Heatmap{From: from, To: to, Timezone: loc.String()}
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		heatmap.Days = append(heatmap.Days, d.String())
+	}
+
+	// The store's lower bound is exclusive, and Postgres keeps only microseconds,
+	// so ask from just before 'from' and keep it inclusive below
+	inRange, _, err := store.List(r.Context(), ListFilter{CreatedAfter: from.Add(-time.Microsecond), CreatedBefore: to})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error listing requests", "err", err)
+		writeError(w, r, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	for _, req := range inRange {
+		if req.CreatedAt.Before(from) || !req.CreatedAt.Before(to) {
+			continue
+		}
+		local := req.CreatedAt.In(loc)
+		heatmap.Counts[local.Weekday()][local.Hour()]++
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(heatmap); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding response", "err", err)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// --- Traffic Anomaly Detection ---
+
+// Minimum absolute values before a deviation is worth alerting on, so a quiet
+// service going from 1 to 4 creates a minute doesn't page anyone.
+const (
+	minCreatesForAlert   = 10
+	minErrorRateForAlert = 0.05
+	minLatencyForAlertMs = 100
+)
+
+// trafficWindow accumulates counters for the current evaluation interval.
+type trafficWindow struct {
+	requests     int
+	creates      int
+	errors       int
+	latencyTotal time.Duration
+}
+
+// trafficBaseline holds exponentially weighted moving averages of past windows.
+type trafficBaseline struct {
+	createRate float64 // creates per interval
+	errorRate  float64 // fraction of responses with a 5xx status
+	latencyMs  float64 // mean latency in milliseconds
+}
+
+// AnomalyAlert is logged and POSTed to the alert webhook when a metric deviates.
+type AnomalyAlert struct {
+	Metric    string    `json:"metric"`
+	Current   float64   `json:"current"`
+	Baseline  float64   `json:"baseline"`
+	Threshold float64   `json:"threshold"`
+	At        time.Time `json:"at"`
+}
+
+// anomalyDetector compares each interval's traffic with a rolling baseline.
+type anomalyDetector struct {
+	mu        sync.Mutex
+	window    trafficWindow
+	baseline  trafficBaseline
+	samples   int // number of windows folded into the baseline so far
+	interval  time.Duration
+	threshold float64 // alert when current > baseline * threshold
+	alpha     float64 // EWMA smoothing factor
+	warmup    int     // windows to observe before alerting
+	webhook   string
+	client    *http.Client
+}
+
+// newAnomalyDetector builds a detector from ANOMALY_* environment variables.
+func newAnomalyDetector() *anomalyDetector {
+	d := &anomalyDetector{
+		interval:  time.Minute,
+		threshold: 3,
+		alpha:     0.2,
+		warmup:    5,
+		webhook:   os.Getenv("ANOMALY_WEBHOOK_URL"),
+		client:    newOutboundClient(outbound, 5*time.Second),
+	}
+
+	if v, err := strconv.ParseFloat(os.Getenv("ANOMALY_THRESHOLD"), 64); err == nil && v > 1 {
+		d.threshold = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("ANOMALY_INTERVAL")); err == nil && v > 0 {
+		d.interval = v
+	}
+
+	return d
+}
+
+// statusRecorder captures the status code written by the wrapped handler.
+// hijacked is set for WebSocket upgrades, whose duration is how long the
+// connection stayed open rather than a response time, so latency figures skip them.
+type statusRecorder struct {
+	http.ResponseWriter
+	status   int
+	hijacked bool
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	rec.status = code
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+// Hijack lets WebSocket upgrades through; the connection counts as 101 Switching Protocols.
+func (rec *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rec.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("underlying ResponseWriter does not support hijacking")
+	}
+	rec.status = http.StatusSwitchingProtocols
+	rec.hijacked = true
+	return hijacker.Hijack()
+}
+
+// Middleware records every request's outcome and latency into the current
+// window. WebSocket connections are left out, as they would swamp the latency.
+func (d *anomalyDetector) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+		if rec.hijacked {
+			return
+		}
+
+		d.mu.Lock()
+		d.window.requests++
+		d.window.latencyTotal += time.Since(start)
+		if rec.status >= 500 {
+			d.window.errors++
+		}
+		if r.Method == "POST" && r.URL.Path == "/requests" && rec.status == http.StatusCreated {
+			d.window.creates++
+		}
+		d.mu.Unlock()
+	})
+}
+
+// Run evaluates the traffic window once per interval. It never returns.
+func (d *anomalyDetector) Run() {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, alert := range d.evaluate() {
+			d.notify(alert)
+		}
+	}
+}
+
+// evaluate closes the current window, checks it against the baseline and folds it in.
+func (d *anomalyDetector) evaluate() []AnomalyAlert {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	win := d.window
+	d.window = trafficWindow{}
+
+	current := trafficBaseline{createRate: float64(win.creates)}
+	if win.requests > 0 {
+		current.errorRate = float64(win.errors) / float64(win.requests)
+		current.latencyMs = float64(win.latencyTotal.Milliseconds()) / float64(win.requests)
+	}
+
+	var alerts []AnomalyAlert
+	now := time.Now()
+
+	// Only alert once the baseline has seen enough history to be meaningful
+	if d.samples >= d.warmup {
+		check := func(metric string, cur, base, floor float64) {
+			if cur >= floor && cur > base*d.threshold {
+				alerts = append(alerts, AnomalyAlert{Metric: metric, Current: cur, Baseline: base, Threshold: d.threshold, At: now})
+			}
+		}
+		check("request_creation_rate", current.createRate, d.baseline.createRate, minCreatesForAlert)
+		check("error_rate", current.errorRate, d.baseline.errorRate, minErrorRateForAlert)
+		check("latency_ms", current.latencyMs, d.baseline.latencyMs, minLatencyForAlertMs)
+	}
+
+	if d.samples == 0 {
+		d.baseline = current
+	} else {
+		d.baseline.createRate += d.alpha * (current.createRate - d.baseline.createRate)
+		d.baseline.errorRate += d.alpha * (current.errorRate - d.baseline.errorRate)
+		d.baseline.latencyMs += d.alpha * (current.latencyMs - d.baseline.latencyMs)
+	}
+	d.samples++
+
+	return alerts
+}
+
+// notify logs the alert and, if configured, POSTs it to the alert webhook.
+func (d *anomalyDetector) notify(alert AnomalyAlert) {
+	slog.Warn("Traffic anomaly", "metric", alert.Metric, "current", alert.Current, "baseline", alert.Baseline, "threshold", alert.Threshold)
+
+	if d.webhook == "" {
+		return
+	}
+
+	body, err := json.Marshal(alert)
+	if err != nil {
+		slog.Error("Error encoding anomaly alert", "err", err)
+		return
+	}
+
+	resp, err := d.client.Post(d.webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		slog.Error("Error sending anomaly alert webhook", "err", err)
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		slog.Warn("Anomaly alert webhook returned an error", "status", resp.StatusCode)
+	}
+}
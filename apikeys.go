@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- API Keys ---
+
+// apiKeyPrefix marks our keys so they are easy to spot in logs and secret scanners.
+const apiKeyPrefix = "gk_"
+
+// ErrKeyNotFound is returned by a KeyStore when no key matches.
+var ErrKeyNotFound = errors.New("api key not found")
+
+// APIKey is an API key issued to a supplier. Only a SHA-256 hash of the secret
+// is stored; the plaintext is shown once, when the key is created.
+type APIKey struct {
+	ID            int        `json:"id"`
+	SupplierEmail string     `json:"supplier_email"`
+	Prefix        string     `json:"prefix"` // First characters of the key, to tell keys apart
+	Hash          string     `json:"-"`
+	CreatedAt     time.Time  `json:"created_at"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+}
+
+// KeyStore persists API keys. Each storage backend provides one alongside its Store.
+type KeyStore interface {
+	// CreateKey saves a new key, assigning its ID.
+	CreateKey(ctx context.Context, key APIKey) (APIKey, error)
+	// GetKeyByHash returns the key with the given hash, or ErrKeyNotFound.
+	GetKeyByHash(ctx context.Context, hash string) (APIKey, error)
+	// ListKeys returns the keys issued to a supplier, or all keys if supplierEmail is empty.
+	ListKeys(ctx context.Context, supplierEmail string) ([]APIKey, error)
+	// RevokeKey marks a key as revoked, or returns ErrKeyNotFound.
+	RevokeKey(ctx context.Context, id int, at time.Time) error
+}
+
+// keys holds all API keys. It is set up in main next to store.
+var keys KeyStore
+
+// newKeyStore returns the KeyStore that shares a backend with the given Store.
+func newKeyStore(s Store) KeyStore {
+	if sqlS, ok := s.(*sqlStore); ok {
+		return &sqlKeyStore{sqlS}
+	}
+	return newMemoryKeyStore()
+}
+
+// hashAPIKey returns the hex SHA-256 of a plaintext key. Keys are long random
+// strings, so a fast unsalted hash is enough to make a leaked table useless.
+func hashAPIKey(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
+
+// generateAPIKey returns a new random plaintext key.
+func generateAPIKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + hex.EncodeToString(b), nil
+}
+
+// APIKeysHandler handles GET (list) and POST (issue) on /api-keys. Admin only.
+func APIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		listAPIKeys(w, r)
+	case "POST":
+		createAPIKey(w, r)
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// APIKeyHandler handles DELETE /api-keys/{id}, revoking a key. Admin only.
+func APIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "DELETE" {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api-keys/"))
+	if err != nil || id <= 0 {
+		writeError(w, r, http.StatusNotFound, "API key not found")
+		return
+	}
+
+	err = keys.RevokeKey(r.Context(), id, time.Now())
+	if errors.Is(err, ErrKeyNotFound) {
+		writeError(w, r, http.StatusNotFound, "API key not found")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error revoking API key", "key_id", id, "err", err)
+		writeError(w, r, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "API key revoked", "key_id", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listAPIKeys returns issued keys (without secrets), optionally filtered by supplier_email.
+func listAPIKeys(w http.ResponseWriter, r *http.Request) {
+	list, err := keys.ListKeys(r.Context(), normalizeEmail(r.URL.Query().Get("supplier_email")))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error listing API keys", "err", err)
+		writeError(w, r, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(list); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding response", "err", err)
+	}
+}
+
+// apiKeyInput is the body of POST /api-keys.
+type apiKeyInput struct {
+	SupplierEmail string `json:"supplier_email"`
+}
+
+// apiKeyCreated is the response to POST /api-keys, the only time the key is shown.
+type apiKeyCreated struct {
+	Key    string `json:"key"`
+	APIKey APIKey `json:"api_key"`
+}
+
+// createAPIKey issues a key for a supplier. The plaintext is only returned here.
+func createAPIKey(w http.ResponseWriter, r *http.Request) {
+	var body apiKeyInput
+	if !decodeJSONBody(w, r, &body) {
+		return
+	}
+
+	body.SupplierEmail = normalizeEmail(body.SupplierEmail)
+	if body.SupplierEmail == "" {
+		writeAPIError(w, r, http.StatusBadRequest, APIError{
+			Code:    codeValidationFailed,
+			Message: "Missing required field (supplier_email)",
+			Details: map[string]string{"supplier_email": "required"},
+		})
+		return
+	}
+
+	plaintext, err := generateAPIKey()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error generating API key", "err", err)
+		writeError(w, r, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	key, err := keys.CreateKey(r.Context(), APIKey{
+		SupplierEmail: body.SupplierEmail,
+		Prefix:        plaintext[:len(apiKeyPrefix)+8],
+		Hash:          hashAPIKey(plaintext),
+		CreatedAt:     time.Now(),
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error creating API key", "err", err)
+		writeError(w, r, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "API key issued", "key_id", key.ID, "supplier", key.SupplierEmail)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	resp := apiKeyCreated{Key: plaintext, APIKey: key}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding response", "err", err)
+	}
+}
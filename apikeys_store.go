@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+)
+
+// memoryKeyStore keeps API keys in a slice, next to the in-memory Store.
+type memoryKeyStore struct {
+	mu     sync.Mutex
+	keys   []APIKey
+	nextID int
+}
+
+// newMemoryKeyStore returns an empty in-memory key store.
+func newMemoryKeyStore() *memoryKeyStore {
+	return &memoryKeyStore{nextID: 1}
+}
+
+func (s *memoryKeyStore) CreateKey(ctx context.Context, key APIKey) (APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key.ID = s.nextID
+	s.nextID++
+	s.keys = append(s.keys, key)
+
+	return key, nil
+}
+
+func (s *memoryKeyStore) GetKeyByHash(ctx context.Context, hash string) (APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range s.keys {
+		if key.Hash == hash {
+			return key, nil
+		}
+	}
+	return APIKey{}, ErrKeyNotFound
+}
+
+func (s *memoryKeyStore) ListKeys(ctx context.Context, supplierEmail string) ([]APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := []APIKey{}
+	for _, key := range s.keys {
+		if supplierEmail == "" || key.SupplierEmail == supplierEmail {
+			result = append(result, key)
+		}
+	}
+	return result, nil
+}
+
+func (s *memoryKeyStore) RevokeKey(ctx context.Context, id int, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.keys {
+		if s.keys[i].ID == id && s.keys[i].RevokedAt == nil {
+			s.keys[i].RevokedAt = &at
+			return nil
+		}
+	}
+	return ErrKeyNotFound
+}
+
+// sqlKeyStore keeps API keys in the api_keys table of a SQL backend.
+type sqlKeyStore struct {
+	*sqlStore
+}
+
+const sqlAPIKeyColumns = `id, supplier_email, prefix, key_hash, created_at, revoked_at`
+
+// scanAPIKey reads one row selected with sqlAPIKeyColumns.
+func scanAPIKey(row rowScanner) (APIKey, error) {
+	var key APIKey
+	var revokedAt sql.NullTime
+
+	if err := row.Scan(&key.ID, &key.SupplierEmail, &key.Prefix, &key.Hash, &key.CreatedAt, &revokedAt); err != nil {
+		return APIKey{}, err
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	return key, nil
+}
+
+func (s *sqlKeyStore) CreateKey(ctx context.Context, key APIKey) (APIKey, error) {
+	err := s.db.QueryRowContext(ctx, s.q(
+		`INSERT INTO api_keys (supplier_email, prefix, key_hash, created_at) VALUES ($1, $2, $3, $4) RETURNING id`),
+		key.SupplierEmail, key.Prefix, key.Hash, s.t(key.CreatedAt),
+	).Scan(&key.ID)
+	if err != nil {
+		return APIKey{}, err
+	}
+	return key, nil
+}
+
+func (s *sqlKeyStore) GetKeyByHash(ctx context.Context, hash string) (APIKey, error) {
+	row := s.db.QueryRowContext(ctx, s.q(`SELECT `+sqlAPIKeyColumns+` FROM api_keys WHERE key_hash = $1`), hash)
+
+	key, err := scanAPIKey(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return APIKey{}, ErrKeyNotFound
+	}
+	return key, err
+}
+
+func (s *sqlKeyStore) ListKeys(ctx context.Context, supplierEmail string) ([]APIKey, error) {
+	query := `SELECT ` + sqlAPIKeyColumns + ` FROM api_keys`
+	var args []any
+	if supplierEmail != "" {
+		query += ` WHERE supplier_email = $1`
+		args = append(args, supplierEmail)
+	}
+	query += ` ORDER BY id`
+
+	rows, err := s.db.QueryContext(ctx, s.q(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, key)
+	}
+	return result, rows.Err()
+}
+
+func (s *sqlKeyStore) RevokeKey(ctx context.Context, id int, at time.Time) error {
+	res, err := s.db.ExecContext(ctx, s.q(`UPDATE api_keys SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL`), s.t(at), id)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrKeyNotFound
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// --- Authentication and Scoping ---
+
+// Caller roles. Suppliers and clients are scoped to their own requests; the others are trusted.
+const (
+	RoleAnonymous = ""
+	RoleAdmin     = "admin"
+	RoleSupplier  = "supplier"
+	RoleClient    = "client"  // Only from JWTs; sees requests where they are the client
+	RoleService   = "service" // Internal caller authenticated over mTLS
+	RolePartner   = "partner" // Partner authenticated by message signature
+)
+
+// Caller is who made a request, as established by AuthHandler.
+type Caller struct {
+	Role  string
+	Name  string // Service or partner name, for logs
+	Email string // The supplier's address for RoleSupplier, the client's for RoleClient
+}
+
+// Authentication settings. With REQUIRE_API_KEYS unset the API stays open as
+// before, except that issuing keys always needs an admin. When set, every
+// non-public route needs a credential: an API key, a JWT, mTLS or a partner signature.
+var (
+	adminAPIKey    = os.Getenv("ADMIN_API_KEY")
+	requireAPIKeys = os.Getenv("REQUIRE_API_KEYS") == "true"
+)
+
+// Authentication failures that are the caller's fault, answered with a 401.
+var (
+	errMalformedAuthorization = errors.New("Authorization header must be 'Bearer <key or token>'")
+	errInvalidAPIKey          = errors.New("invalid API key")
+)
+
+// callerKey is the context key for the request's Caller.
+type callerKey struct{}
+
+// callerFromContext returns the authenticated caller (RoleAnonymous if none).
+func callerFromContext(ctx context.Context) Caller {
+	caller, _ := ctx.Value(callerKey{}).(Caller)
+	return caller
+}
+
+// isAdmin reports whether the caller may use admin endpoints.
+func (c Caller) isAdmin() bool {
+	return c.Role == RoleAdmin || c.Role == RoleService
+}
+
+// canAccess reports whether the caller may read or write the given request.
+func (c Caller) canAccess(req Request) bool {
+	switch c.Role {
+	case RoleSupplier:
+		return c.Email == req.SupplierEmail
+	case RoleClient:
+		return c.Email == req.ClientEmail
+	case RolePartner:
+		// Partners deliver new requests; a redelivery gets its original response
+		// from the replay cache, but stored requests aren't theirs to read or change
+		return req.ID == 0
+	case RoleAnonymous:
+		return !requireAPIKeys
+	case RoleAdmin, RoleService:
+		return true
+	default:
+		return false
+	}
+}
+
+// publicPaths never require authentication.
+var publicPaths = map[string]bool{
+	"/version":      true,
+	"/openapi.json": true,
+	"/docs":         true,
+}
+
+// canAccessSupplier reports whether the caller may act for a supplier, e.g. manage their webhooks.
+func (c Caller) canAccessSupplier(supplierEmail string) bool {
+	switch c.Role {
+	case RoleSupplier:
+		return c.Email == supplierEmail
+	case RoleClient, RolePartner:
+		return false
+	case RoleAnonymous:
+		return !requireAPIKeys
+	case RoleAdmin, RoleService:
+		return true
+	default:
+		return false
+	}
+}
+
+// scope describes what a scoped caller is limited to, for error messages.
+func (c Caller) scope() string {
+	return c.Role + " " + c.Email
+}
+
+// adminOnly reports whether a path is restricted to admins. Key management and
+// the /admin/ endpoints always are; /metrics and bulk import are once API keys
+// are required.
+func adminOnly(path string) bool {
+	if path == "/api-keys" || strings.HasPrefix(path, "/api-keys/") || strings.HasPrefix(path, "/admin/") {
+		return true
+	}
+	return requireAPIKeys && (path == "/metrics" || path == "/requests/import")
+}
+
+// authenticate works out the caller from mTLS identity, partner signature or bearer token.
+func authenticate(r *http.Request) (Caller, error) {
+	if service, ok := serviceIdentityFromContext(r.Context()); ok {
+		return Caller{Role: RoleService, Name: service}, nil
+	}
+	if sig, ok := partnerSignatureFromContext(r.Context()); ok {
+		return Caller{Role: RolePartner, Name: sig.Partner}, nil
+	}
+
+	header := r.Header.Get("Authorization")
+	// Browsers can't set headers on a WebSocket handshake, so /ws also takes ?access_token=
+	if header == "" && r.URL.Path == "/ws" {
+		if token := r.URL.Query().Get("access_token"); token != "" {
+			header = "Bearer " + token
+		}
+	}
+	if header == "" {
+		return Caller{}, nil
+	}
+
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok || token == "" {
+		return Caller{}, errMalformedAuthorization
+	}
+
+	if adminAPIKey != "" && subtle.ConstantTimeCompare([]byte(token), []byte(adminAPIKey)) == 1 {
+		return Caller{Role: RoleAdmin, Name: "admin"}, nil
+	}
+
+	// API keys never contain dots, so anything shaped like a JWT is treated as one
+	if jwtEnabled() && strings.Count(token, ".") == 2 {
+		return callerFromJWT(r.Context(), token, time.Now())
+	}
+
+	key, err := keys.GetKeyByHash(r.Context(), hashAPIKey(token))
+	if errors.Is(err, ErrKeyNotFound) || (err == nil && key.RevokedAt != nil) {
+		return Caller{}, errInvalidAPIKey
+	}
+	if err != nil {
+		return Caller{}, err
+	}
+
+	return Caller{Role: RoleSupplier, Email: key.SupplierEmail}, nil
+}
+
+// AuthHandler authenticates every request and enforces which paths need a caller.
+func AuthHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// CORS preflights carry no credentials
+		if r.Method == "OPTIONS" || publicPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		caller, err := authenticate(r)
+		if errors.Is(err, errMalformedAuthorization) || errors.Is(err, errInvalidAPIKey) || errors.Is(err, errInvalidToken) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+			writeError(w, r, http.StatusUnauthorized, "Unauthorized: "+err.Error())
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error authenticating request", "err", err)
+			writeError(w, r, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+
+		if caller.Role == RoleAnonymous && (requireAPIKeys || adminOnly(r.URL.Path)) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+			writeError(w, r, http.StatusUnauthorized, "Unauthorized: API key required")
+			return
+		}
+		if adminOnly(r.URL.Path) && !caller.isAdmin() {
+			writeError(w, r, http.StatusForbidden, "Forbidden")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), callerKey{}, caller)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
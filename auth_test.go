@@ -0,0 +1,42 @@
+package main
+
+import "testing"
+
+func TestCanAccess(t *testing.T) {
+	saved := requireAPIKeys
+	t.Cleanup(func() { requireAPIKeys = saved })
+	requireAPIKeys = true
+
+	stored := Request{ID: 7, ClientEmail: "c@b.co", SupplierEmail: "s@b.co"}
+	fresh := stored
+	fresh.ID = 0
+
+	tests := []struct {
+		name         string
+		caller       Caller
+		req          Request
+		want         bool
+		wantSupplier bool
+	}{
+		{name: "admin", caller: Caller{Role: RoleAdmin}, req: stored, want: true, wantSupplier: true},
+		{name: "service", caller: Caller{Role: RoleService}, req: stored, want: true, wantSupplier: true},
+		{name: "own supplier", caller: Caller{Role: RoleSupplier, Email: "s@b.co"}, req: stored, want: true, wantSupplier: true},
+		{name: "other supplier", caller: Caller{Role: RoleSupplier, Email: "x@b.co"}, req: stored},
+		{name: "own client", caller: Caller{Role: RoleClient, Email: "c@b.co"}, req: stored, want: true},
+		{name: "partner creating", caller: Caller{Role: RolePartner, Name: "acme"}, req: fresh, want: true},
+		{name: "partner reading a stored request", caller: Caller{Role: RolePartner, Name: "acme"}, req: stored},
+		{name: "anonymous with keys required", caller: Caller{}, req: stored},
+		{name: "unknown role", caller: Caller{Role: "superuser"}, req: stored},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.caller.canAccess(tt.req); got != tt.want {
+				t.Errorf("canAccess = %v, want %v", got, tt.want)
+			}
+			if got := tt.caller.canAccessSupplier(tt.req.SupplierEmail); got != tt.wantSupplier {
+				t.Errorf("canAccessSupplier = %v, want %v", got, tt.wantSupplier)
+			}
+		})
+	}
+}
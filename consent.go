@@ -0,0 +1,117 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// --- Terms Consent ---
+
+// Consent configuration. When REQUIRE_CONSENT is "true", POST /requests is
+// rejected unless the client accepted the current TERMS_VERSION, which main
+// requires to be set.
+var (
+	termsVersion   = os.Getenv("TERMS_VERSION")
+	requireConsent = os.Getenv("REQUIRE_CONSENT") == "true"
+)
+
+// Consent records a client's acceptance of the terms at request creation.
+// The client supplies TermsVersion; AcceptedAt and IP are always set server-side.
+type Consent struct {
+	TermsVersion string    `json:"terms_version"`
+	AcceptedAt   time.Time `json:"accepted_at"`
+	IP           string    `json:"ip"`
+}
+
+// trustedProxies are the reverse proxies allowed to report the client address
+// in X-Forwarded-For, from TRUSTED_PROXIES: comma separated IPs or CIDR ranges,
+// e.g. "10.0.0.0/8" behind Render. It is loaded in main once logging is set up.
+// Without it the header is ignored, since anyone can send one.
+var trustedProxies []*net.IPNet
+
+// loadTrustedProxies reads TRUSTED_PROXIES, skipping entries that don't parse.
+func loadTrustedProxies() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, entry := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		cidr := entry
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			slog.Warn("Ignoring invalid TRUSTED_PROXIES entry", "value", entry)
+			continue
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+// isTrustedProxy reports whether ip is one of trustedProxies.
+func isTrustedProxy(ip net.IP) bool {
+	for _, n := range trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the caller's address. When the connection comes from a
+// trusted proxy, X-Forwarded-For is read from the right, skipping the trusted
+// hops, so the answer is the address our own proxies saw rather than whatever
+// the client put at the front of the header.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !isTrustedProxy(ip) {
+		return host
+	}
+
+	var hops []string
+	for _, fwd := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(fwd, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break // A malformed hop, so nothing left of it can be trusted
+		}
+		host = hop.String()
+		if !isTrustedProxy(hop) {
+			break
+		}
+	}
+	return host
+}
+
+// checkConsent stamps the consent record on a new request and reports whether
+// creation may proceed under the current consent policy.
+func checkConsent(req *Request, r *http.Request) bool {
+	if req.Consent != nil {
+		req.Consent.AcceptedAt = time.Now()
+		req.Consent.IP = clientIP(r)
+	}
+
+	if !requireConsent {
+		return true
+	}
+
+	return req.Consent != nil && req.Consent.TermsVersion == termsVersion
+}
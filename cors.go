@@ -0,0 +1,117 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// --- CORS Policy ---
+
+// Cross-origin access is configured from the environment:
+//
+//	CORS_ALLOWED_ORIGINS     comma separated origins, e.g. "https://app.example.com"; "*" allows any (default)
+//	CORS_ALLOW_CREDENTIALS   "true" lets browsers send cookies/Authorization cross-origin
+//	CORS_MAX_AGE             seconds browsers may cache a preflight (default 600)
+//
+// Credentials are never combined with "*": browsers reject it, and echoing any
+// origin back would let every site make authenticated calls.
+
+type corsPolicy struct {
+	anyOrigin        bool
+	origins          map[string]bool
+	allowCredentials bool
+	maxAge           string
+}
+
+// cors is the policy applied by CORSHandler. It is loaded in main once logging is set up.
+var cors *corsPolicy
+
+// loadCORSPolicy reads the policy from the environment.
+func loadCORSPolicy() *corsPolicy {
+	p := &corsPolicy{
+		origins:          map[string]bool{},
+		allowCredentials: os.Getenv("CORS_ALLOW_CREDENTIALS") == "true",
+		maxAge:           "600",
+	}
+
+	allowed := os.Getenv("CORS_ALLOWED_ORIGINS")
+	if allowed == "" {
+		allowed = "*"
+	}
+	for _, origin := range splitHostList(allowed) {
+		if origin == "*" {
+			p.anyOrigin = true
+			continue
+		}
+		// Stored lowercased, as allowOrigin looks origins up case-insensitively
+		p.origins[strings.ToLower(strings.TrimSuffix(origin, "/"))] = true
+	}
+
+	if p.anyOrigin && p.allowCredentials {
+		slog.Warn("CORS_ALLOW_CREDENTIALS is ignored while CORS_ALLOWED_ORIGINS allows any origin")
+		p.allowCredentials = false
+	}
+
+	if v := os.Getenv("CORS_MAX_AGE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			p.maxAge = strconv.Itoa(n)
+		} else {
+			slog.Warn("Ignoring invalid CORS_MAX_AGE", "value", v)
+		}
+	}
+
+	return p
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin value for origin, or "" if it isn't allowed.
+func (p *corsPolicy) allowOrigin(origin string) string {
+	if p.anyOrigin {
+		return "*"
+	}
+	if p.origins[strings.ToLower(origin)] {
+		return origin
+	}
+	return ""
+}
+
+// CORSHandler wrapper to add CORS headers. methods are the ones the route
+// serves; preflights advertise exactly those.
+func CORSHandler(next http.HandlerFunc, methods ...string) http.HandlerFunc {
+	allowMethods := strings.Join(append(methods, "OPTIONS"), ", ")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == "OPTIONS"
+
+		if origin != "" {
+			// The response depends on Origin, so shared caches must key on it
+			h.Add("Vary", "Origin")
+
+			if allowed := cors.allowOrigin(origin); allowed != "" {
+				h.Set("Access-Control-Allow-Origin", allowed)
+				if cors.allowCredentials {
+					h.Set("Access-Control-Allow-Credentials", "true")
+				}
+				h.Set("Access-Control-Expose-Headers", "X-Total-Count, X-Request-ID, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset, Retry-After")
+			} else if preflight {
+				writeError(w, r, http.StatusForbidden, "Origin not allowed")
+				return
+			}
+		}
+
+		if preflight {
+			h.Set("Allow", allowMethods)
+			h.Set("Access-Control-Allow-Methods", allowMethods)
+			h.Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Content-Digest, Signature, Signature-Input, X-Request-ID")
+			h.Set("Access-Control-Max-Age", cors.maxAge)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		next(w, r)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/mail"
+	"os"
+	"strings"
+)
+
+// foldGmailAddresses enables gmail dot/plus folding, so "j.doe+gigs@gmail.com"
+// and "jdoe@gmail.com" are treated as the same mailbox. Off by default.
+var foldGmailAddresses = os.Getenv("EMAIL_FOLD_GMAIL") == "true"
+
+// normalizeEmail trims and lowercases an address, and folds gmail variants when enabled.
+func normalizeEmail(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	if !foldGmailAddresses {
+		return email
+	}
+
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return email
+	}
+	local, domain := email[:at], email[at+1:]
+
+	if domain != "gmail.com" && domain != "googlemail.com" {
+		return email
+	}
+
+	// Gmail ignores dots and anything after a "+" in the local part
+	if plus := strings.Index(local, "+"); plus >= 0 {
+		local = local[:plus]
+	}
+	local = strings.ReplaceAll(local, ".", "")
+
+	return local + "@gmail.com"
+}
+
+// maxEmailLength is the longest address SMTP allows (RFC 5321 forward-path limit).
+const maxEmailLength = 254
+
+// validEmail reports whether email is a bare addr-spec such as "bob@example.com",
+// without a display name or angle brackets, and with a dotted domain.
+func validEmail(email string) bool {
+	if len(email) > maxEmailLength {
+		return false
+	}
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Name != "" || addr.Address != email {
+		return false
+	}
+	domain := email[strings.LastIndex(email, "@")+1:]
+	return strings.Contains(domain, ".") && !strings.HasPrefix(domain, ".") && !strings.HasSuffix(domain, ".")
+}
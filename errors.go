@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// --- Error Responses ---
+
+// APIError is the body of every error response, wrapped as {"error": {...}}
+// so clients can tell failures apart from data by shape alone.
+type APIError struct {
+	Code      string            `json:"code"`              // Stable, machine-readable, e.g. "not_found"
+	Message   string            `json:"message"`           // Human-readable, may change
+	Details   map[string]string `json:"details,omitempty"` // Field or parameter name -> problem
+	RequestID string            `json:"request_id,omitempty"`
+}
+
+type errorEnvelope struct {
+	Error APIError `json:"error"`
+}
+
+// Error codes beyond the ones derived from the HTTP status.
+const (
+	codeInvalidParameter  = "invalid_parameter"
+	codeValidationFailed  = "validation_failed"
+	codeConsentRequired   = "consent_required"
+	codeInvalidTransition = "invalid_transition"
+)
+
+// writeError writes a JSON error whose code is derived from the status,
+// e.g. 404 -> "not_found".
+func writeError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	writeAPIError(w, r, status, APIError{Message: message})
+}
+
+// invalidParam writes a 400 for a bad query parameter.
+func invalidParam(w http.ResponseWriter, r *http.Request, name, problem string) {
+	writeAPIError(w, r, http.StatusBadRequest, APIError{
+		Code:    codeInvalidParameter,
+		Message: "Invalid '" + name + "' parameter: " + problem,
+		Details: map[string]string{name: problem},
+	})
+}
+
+// writeAPIError writes e as the response body, filling in the code and request ID.
+func writeAPIError(w http.ResponseWriter, r *http.Request, status int, e APIError) {
+	if e.Code == "" {
+		e.Code = statusCode(status)
+	}
+	// Include the request ID so a failure can be matched to our logs
+	e.RequestID = requestIDFromContext(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(errorEnvelope{Error: e}); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding error response", "err", err)
+	}
+}
+
+// statusCode turns a status into a snake_case code, e.g. "method_not_allowed".
+func statusCode(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "error"
+	}
+	return strings.ReplaceAll(strings.ToLower(text), " ", "_")
+}
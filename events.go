@@ -0,0 +1,15 @@
+package main
+
+import "context"
+
+// publishRequestEvent fans a request lifecycle event out to webhooks and
+// WebSocket subscribers, and emails the supplier about new requests. None of
+// them block the calling handler.
+func publishRequestEvent(ctx context.Context, event string, req Request) {
+	dispatcher.Publish(ctx, event, req)
+	hub.Publish(event, req)
+
+	if event == EventRequestCreated {
+		notifications.NotifyNewRequest(ctx, req)
+	}
+}
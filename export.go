@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/csv"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- CSV Export ---
+
+// exportBatchSize is how many requests are read from the store per query while streaming.
+const exportBatchSize = 500
+
+// exportColumns is the CSV header row.
+var exportColumns = []string{"id", "gig_title", "client", "client_email", "supplier_email", "details", "status", "created_at", "deleted_at", "consent_terms_version", "consent_accepted_at", "consent_ip"}
+
+// ExportRequestsHandler handles GET /requests/export?format=csv. It takes the
+// same filters and sorting as GET /requests, but returns every match unless a
+// limit is given, streamed in batches so large exports never sit in memory.
+func ExportRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if format := r.URL.Query().Get("format"); format != "" && format != "csv" {
+		invalidParam(w, r, "format", "must be csv")
+		return
+	}
+
+	filter, ok := parseListFilter(w, r, false)
+	if !ok {
+		return
+	}
+
+	// Read the first batch before committing to a 200, so store errors still get a proper response
+	remaining := filter.Limit
+	batch := nextExportBatch(&filter, remaining)
+	page, _, err := store.List(r.Context(), batch)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error exporting requests", "err", err)
+		writeError(w, r, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	filename := "requests-" + time.Now().UTC().Format("20060102") + ".csv"
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.WriteHeader(http.StatusOK)
+
+	out := csv.NewWriter(w)
+	out.Write(exportColumns)
+
+	exported := 0
+	for {
+		for _, req := range page {
+			out.Write(exportRow(req))
+		}
+		exported += len(page)
+		out.Flush()
+		if err := out.Error(); err != nil {
+			slog.ErrorContext(r.Context(), "Error writing export", "err", err)
+			return
+		}
+
+		if remaining > 0 {
+			remaining -= len(page)
+		}
+		if len(page) < batch.Limit || (filter.Limit > 0 && remaining <= 0) {
+			break
+		}
+
+		batch = nextExportBatch(&filter, remaining)
+		if page, _, err = store.List(r.Context(), batch); err != nil {
+			// Headers are gone; all we can do is cut the file short
+			slog.ErrorContext(r.Context(), "Error exporting requests", "err", err, "exported", exported)
+			return
+		}
+	}
+
+	slog.InfoContext(r.Context(), "Requests exported", "rows", exported)
+}
+
+// nextExportBatch returns the query for the next batch and advances filter's offset past it.
+func nextExportBatch(filter *ListFilter, remaining int) ListFilter {
+	batch := *filter
+	batch.Limit = exportBatchSize
+	if remaining > 0 {
+		batch.Limit = min(exportBatchSize, remaining)
+	}
+	filter.Offset += batch.Limit
+	return batch
+}
+
+// exportRow formats one request as CSV fields.
+func exportRow(req Request) []string {
+	deletedAt := ""
+	if req.DeletedAt != nil {
+		deletedAt = req.DeletedAt.UTC().Format(time.RFC3339)
+	}
+	var consent Consent
+	consentAt := ""
+	if req.Consent != nil {
+		consent = *req.Consent
+		consentAt = consent.AcceptedAt.UTC().Format(time.RFC3339)
+	}
+
+	return []string{
+		strconv.Itoa(req.ID),
+		spreadsheetSafe(req.GigTitle),
+		spreadsheetSafe(req.Client),
+		spreadsheetSafe(req.ClientEmail),
+		spreadsheetSafe(req.SupplierEmail),
+		spreadsheetSafe(req.Details),
+		string(req.Status),
+		req.CreatedAt.UTC().Format(time.RFC3339),
+		deletedAt,
+		spreadsheetSafe(consent.TermsVersion),
+		consentAt,
+		consent.IP,
+	}
+}
+
+// spreadsheetSafe stops user text from being run as a formula when the CSV is
+// opened in a spreadsheet, by prefixing a quote to cells that start like one.
+// Text that already starts with quotes before such a character gets one more,
+// so spreadsheetUnsafe can always undo it and exports re-import unchanged.
+func spreadsheetSafe(s string) string {
+	if formulaLike(s) {
+		return "'" + s
+	}
+	return s
+}
+
+// spreadsheetUnsafe reverses spreadsheetSafe for a cell read back on import.
+func spreadsheetUnsafe(s string) string {
+	if rest, ok := strings.CutPrefix(s, "'"); ok && formulaLike(rest) {
+		return rest
+	}
+	return s
+}
+
+// formulaLike reports whether s, after any leading quotes, starts like a formula.
+func formulaLike(s string) bool {
+	s = strings.TrimLeft(s, "'")
+	return s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0]))
+}
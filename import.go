@@ -0,0 +1,280 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- Bulk Import ---
+
+// Import limits. An import is one transaction, so it is capped rather than
+// letting a single upload hold the database for minutes.
+const (
+	maxImportBodyBytes = 10 << 20
+	maxImportRows      = 5000
+)
+
+// importResult is one created row in an import report. Row counts data rows
+// from 1, not including a CSV header.
+type importResult struct {
+	Row int `json:"row"`
+	ID  int `json:"id"`
+}
+
+// importReport is the response to a successful import.
+type importReport struct {
+	Created int            `json:"created"`
+	Rows    []importResult `json:"rows"`
+}
+
+// importRow is a parsed row and whatever was wrong with it while parsing.
+type importRow struct {
+	req      Request
+	problems map[string]string
+}
+
+// ImportRequestsHandler handles POST /requests/import, for migrating records
+// from another system. The body is a JSON array of requests or, with
+// Content-Type: text/csv, a CSV file with a header row using the columns of
+// GET /requests/export. Unlike POST /requests, status, created_at and
+// deleted_at are taken as given (status defaults to pending and created_at to
+// now); IDs are always assigned here. Consent is kept as the source system
+// recorded it, with its own accepted_at and ip, and REQUIRE_CONSENT does not
+// apply: a historical row is imported whether or not its client ever consented.
+//
+// Every row is validated first. If any is invalid nothing is created and the
+// 400 lists each problem under "rows[N].field"; a row the caller couldn't create
+// through POST /requests gets a 403 the same way. Otherwise all rows are created
+// in one transaction and the report gives each row's new ID. Imported records
+// are history, not new business, so no webhooks, WebSocket events or emails go out.
+func ImportRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBodyBytes)
+
+	var rows []importRow
+	var err error
+	// Like POST /requests, anything not declared as CSV is read as JSON
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/csv":
+		rows, err = parseImportCSV(r.Body)
+	default:
+		rows, err = parseImportJSON(r.Body)
+	}
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid import: "+err.Error())
+		return
+	}
+	if len(rows) == 0 {
+		writeError(w, r, http.StatusBadRequest, "Invalid import: no rows")
+		return
+	}
+
+	caller := callerFromContext(r.Context())
+	problems := map[string]string{}
+	forbidden := map[string]string{}
+	invalid := 0
+	reqs := make([]Request, len(rows))
+	for i, row := range rows {
+		req := row.req
+
+		// Scoped callers import for themselves unless told otherwise, as on POST /requests
+		if caller.Role == RoleSupplier && req.SupplierEmail == "" {
+			req.SupplierEmail = caller.Email
+		}
+		if caller.Role == RoleClient && req.ClientEmail == "" {
+			req.ClientEmail = caller.Email
+		}
+
+		rowProblems := requestProblems(&req)
+		for field, problem := range row.problems {
+			rowProblems[field] = problem
+		}
+
+		switch {
+		case req.Status == "":
+			req.Status = StatusPending
+		case !validStatus(req.Status):
+			rowProblems["status"] = "unknown status " + strconv.Quote(string(req.Status))
+		}
+		if req.Consent != nil {
+			if req.Consent.TermsVersion == "" {
+				rowProblems["consent.terms_version"] = "required when consent is given"
+			}
+			if req.Consent.AcceptedAt.IsZero() {
+				rowProblems["consent.accepted_at"] = "required when consent is given"
+			}
+		}
+		req.ID = 0
+		if len(rowProblems) == 0 && !caller.canAccess(req) {
+			forbidden[fmt.Sprintf("rows[%d]", i+1)] = "credentials are scoped to " + caller.scope()
+		}
+		if req.CreatedAt.IsZero() {
+			req.CreatedAt = time.Now()
+		}
+
+		if len(rowProblems) > 0 {
+			invalid++
+		}
+		for field, problem := range rowProblems {
+			problems[fmt.Sprintf("rows[%d].%s", i+1, field)] = problem
+		}
+		reqs[i] = req
+	}
+
+	if invalid == 0 && len(forbidden) > 0 {
+		writeAPIError(w, r, http.StatusForbidden, APIError{
+			Message: fmt.Sprintf("Import rejected: %d of %d rows are outside your scope; nothing was created", len(forbidden), len(rows)),
+			Details: forbidden,
+		})
+		return
+	}
+	if invalid > 0 {
+		writeAPIError(w, r, http.StatusBadRequest, APIError{
+			Code:    codeValidationFailed,
+			Message: fmt.Sprintf("Import rejected: %d of %d rows are invalid; nothing was created", invalid, len(rows)),
+			Details: problems,
+		})
+		return
+	}
+
+	created, err := store.CreateMany(r.Context(), reqs)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error importing requests", "rows", len(reqs), "err", err)
+		writeError(w, r, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	report := importReport{Created: len(created), Rows: make([]importResult, len(created))}
+	for i, req := range created {
+		report.Rows[i] = importResult{Row: i + 1, ID: req.ID}
+	}
+	slog.InfoContext(r.Context(), "Requests imported", "rows", len(created), "first_id", created[0].ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding response", "err", err)
+	}
+}
+
+// parseImportJSON reads a JSON array of requests.
+func parseImportJSON(body io.Reader) ([]importRow, error) {
+	var reqs []Request
+	if err := json.NewDecoder(body).Decode(&reqs); err != nil {
+		return nil, err
+	}
+	if len(reqs) > maxImportRows {
+		return nil, fmt.Errorf("at most %d rows per import", maxImportRows)
+	}
+
+	rows := make([]importRow, len(reqs))
+	for i, req := range reqs {
+		rows[i] = importRow{req: req, problems: map[string]string{}}
+	}
+	return rows, nil
+}
+
+// parseImportCSV reads a CSV file whose header names columns from exportColumns,
+// in any order. The id column is accepted so exports can be re-imported, but
+// ignored, and the export's formula guards (see spreadsheetSafe) are removed.
+func parseImportCSV(body io.Reader) ([]importRow, error) {
+	reader := csv.NewReader(body)
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))) // Spreadsheets often add a BOM
+		if !slices.Contains(exportColumns, name) {
+			return nil, fmt.Errorf("unknown column %q (want %s)", name, strings.Join(exportColumns, ", "))
+		}
+		if _, dup := columns[name]; dup {
+			return nil, fmt.Errorf("duplicate column %q", name)
+		}
+		columns[name] = i
+	}
+
+	var rows []importRow
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(rows) == maxImportRows {
+			return nil, fmt.Errorf("at most %d rows per import", maxImportRows)
+		}
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok {
+				return record[i]
+			}
+			return ""
+		}
+
+		row := importRow{problems: map[string]string{}}
+		row.req = Request{
+			GigTitle:      spreadsheetUnsafe(field("gig_title")),
+			Client:        spreadsheetUnsafe(field("client")),
+			ClientEmail:   spreadsheetUnsafe(field("client_email")),
+			SupplierEmail: spreadsheetUnsafe(field("supplier_email")),
+			Details:       spreadsheetUnsafe(field("details")),
+			Status:        Status(strings.TrimSpace(field("status"))),
+		}
+
+		parseTime := func(name string) *time.Time {
+			value := strings.TrimSpace(field(name))
+			if value == "" {
+				return nil
+			}
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				row.problems[name] = "must be an RFC 3339 timestamp"
+				return nil
+			}
+			return &t
+		}
+		if t := parseTime("created_at"); t != nil {
+			row.req.CreatedAt = *t
+		}
+		row.req.DeletedAt = parseTime("deleted_at")
+
+		// A row whose consent columns are missing or all empty has no consent
+		consent := Consent{
+			TermsVersion: strings.TrimSpace(spreadsheetUnsafe(field("consent_terms_version"))),
+			IP:           strings.TrimSpace(field("consent_ip")),
+		}
+		if t := parseTime("consent_accepted_at"); t != nil {
+			consent.AcceptedAt = *t
+		}
+		if consent != (Consent{}) || row.problems["consent_accepted_at"] != "" {
+			row.req.Consent = &consent
+		}
+
+		rows = append(rows, row)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSpreadsheetSafeRoundTrip(t *testing.T) {
+	tests := []struct {
+		in      string
+		guarded bool
+	}{
+		{"hello", false},
+		{"", false},
+		{"'hello", false},
+		{"=1+1", true},
+		{"+1", true},
+		{"-evil", true},
+		{"@SUM(A1)", true},
+		{"'-already quoted", true},
+		{"''=twice", true},
+		{"a-b", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			safe := spreadsheetSafe(tt.in)
+			if guarded := safe != tt.in; guarded != tt.guarded {
+				t.Errorf("spreadsheetSafe(%q) = %q, guarded %v, want %v", tt.in, safe, guarded, tt.guarded)
+			}
+			if got := spreadsheetUnsafe(safe); got != tt.in {
+				t.Errorf("spreadsheetUnsafe(%q) = %q, want %q", safe, got, tt.in)
+			}
+		})
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	savedRequire, savedTerms := requireConsent, termsVersion
+	t.Cleanup(func() { requireConsent, termsVersion = savedRequire, savedTerms })
+	// Imports are exempt, so rows without consent must still come back
+	requireConsent, termsVersion = true, "v2"
+
+	admin := Caller{Role: RoleAdmin}
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	deleted := created.Add(time.Hour)
+	consent := &Consent{TermsVersion: "v1", AcceptedAt: created.Add(-time.Minute), IP: "203.0.113.7"}
+
+	tests := []struct {
+		name string
+		req  Request
+	}{
+		{name: "plain", req: Request{GigTitle: "Plain", Details: "Line one\nline two, \"quoted\""}},
+		{name: "formula-like title", req: Request{GigTitle: "-evil", Client: "@client", Details: "=1+1"}},
+		{name: "quoted formula", req: Request{GigTitle: "'-x"}},
+		{name: "leading quote", req: Request{GigTitle: "'hello"}},
+		{name: "non-ASCII", req: Request{GigTitle: "Café ☕", Client: "Zoë"}},
+		{name: "with consent", req: Request{Consent: consent}},
+		{name: "completed", req: Request{Status: StatusCompleted}},
+		{name: "deleted", req: Request{DeletedAt: &deleted}},
+	}
+
+	forEachStore(t, func(t *testing.T, s Store) {
+		useStore(t, s)
+		var originals []Request
+		for _, tt := range tests {
+			req := tt.req
+			req.CreatedAt = created
+			originals = append(originals, req)
+		}
+		originals = seedRequests(t, s, originals...)
+
+		w := serve(ExportRequestsHandler, admin, "GET", "/requests/export?include_deleted=true", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("export status %d: %s", w.Code, w.Body)
+		}
+		exported := w.Body.String()
+
+		// Import into an empty store of the same kind
+		for _, req := range originals {
+			if err := s.Delete(context.Background(), req.ID); err != nil {
+				t.Fatal(err)
+			}
+		}
+		r := httptest.NewRequest("POST", "/requests/import", strings.NewReader(exported))
+		r.Header.Set("Content-Type", "text/csv")
+		r = r.WithContext(context.WithValue(r.Context(), callerKey{}, admin))
+		w = httptest.NewRecorder()
+		ImportRequestsHandler(w, r)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("import status %d: %s", w.Code, w.Body)
+		}
+		var report importReport
+		if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+			t.Fatal(err)
+		}
+		if report.Created != len(tests) {
+			t.Fatalf("imported %d rows, want %d", report.Created, len(tests))
+		}
+
+		for i, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				got, err := s.Get(context.Background(), report.Rows[i].ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := originals[i]
+				want.ID, got.ID = 0, 0
+				if !reflect.DeepEqual(normalizeTimes(got), normalizeTimes(want)) {
+					t.Errorf("round trip changed the request\ngot:  %+v\nwant: %+v", got, want)
+				}
+			})
+		}
+
+		// A second export of the imported rows is the same file, bar the new IDs
+		w = serve(ExportRequestsHandler, admin, "GET", "/requests/export?include_deleted=true", "")
+		if stripIDs(t, w.Body.String()) != stripIDs(t, exported) {
+			t.Errorf("re-export differs\ngot:\n%s\nwant:\n%s", w.Body, exported)
+		}
+	})
+}
+
+// normalizeTimes puts a request's times in UTC, as stores may read them back in another zone.
+func normalizeTimes(req Request) Request {
+	req.CreatedAt = req.CreatedAt.UTC()
+	if req.DeletedAt != nil {
+		deleted := req.DeletedAt.UTC()
+		req.DeletedAt = &deleted
+	}
+	if req.Consent != nil {
+		consent := *req.Consent
+		consent.AcceptedAt = consent.AcceptedAt.UTC()
+		req.Consent = &consent
+	}
+	return req
+}
+
+// stripIDs blanks the id column of an export.
+func stripIDs(t *testing.T, export string) string {
+	t.Helper()
+
+	records, err := csv.NewReader(strings.NewReader(export)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	w := csv.NewWriter(&out)
+	for _, record := range records[1:] {
+		record[0] = ""
+		w.Write(record)
+	}
+	w.Flush()
+	return out.String()
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- JWT Verification ---
+
+// JWT settings. Tokens are verified with JWT_SECRET (HS256) or with keys from
+// JWT_JWKS_URL (RS256/ES256); JWT auth is off when neither is set.
+var (
+	jwtSecret   = []byte(os.Getenv("JWT_SECRET"))
+	jwtJWKSURL  = os.Getenv("JWT_JWKS_URL")
+	jwtIssuer   = os.Getenv("JWT_ISSUER")   // Required "iss" when set
+	jwtAudience = os.Getenv("JWT_AUDIENCE") // Required in "aud" when set
+)
+
+// jwtLeeway tolerates small clock differences when checking exp and nbf.
+const jwtLeeway = 30 * time.Second
+
+// errInvalidToken is returned for any JWT that fails verification.
+var errInvalidToken = errors.New("invalid token")
+
+// jwtEnabled reports whether bearer tokens may be JWTs.
+func jwtEnabled() bool {
+	return len(jwtSecret) > 0 || jwtJWKSURL != ""
+}
+
+// jwtClaims are the claims we read from a token.
+type jwtClaims struct {
+	Email     string          `json:"email"`
+	Role      string          `json:"role"`
+	Issuer    string          `json:"iss"`
+	Audience  json.RawMessage `json:"aud"` // A string or an array of strings
+	ExpiresAt *int64          `json:"exp"`
+	NotBefore *int64          `json:"nbf"`
+}
+
+// hasAudience reports whether the aud claim contains want.
+func (c jwtClaims) hasAudience(want string) bool {
+	var single string
+	if json.Unmarshal(c.Audience, &single) == nil {
+		return single == want
+	}
+	var list []string
+	if json.Unmarshal(c.Audience, &list) == nil {
+		for _, aud := range list {
+			if aud == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// callerFromJWT verifies a token and maps its claims to a Caller.
+func callerFromJWT(ctx context.Context, token string, now time.Time) (Caller, error) {
+	claims, err := verifyJWT(token, now)
+	if err != nil {
+		slog.InfoContext(ctx, "Rejected JWT", "err", err)
+		return Caller{}, errInvalidToken
+	}
+
+	email := normalizeEmail(claims.Email)
+	switch claims.Role {
+	case RoleAdmin:
+		return Caller{Role: RoleAdmin, Name: email, Email: email}, nil
+	case RoleSupplier, RoleClient:
+		if email == "" {
+			slog.InfoContext(ctx, "Rejected JWT: token has no email claim", "role", claims.Role)
+			return Caller{}, errInvalidToken
+		}
+		return Caller{Role: claims.Role, Email: email}, nil
+	default:
+		slog.InfoContext(ctx, "Rejected JWT: unknown role", "role", claims.Role)
+		return Caller{}, errInvalidToken
+	}
+}
+
+// verifyJWT checks a compact JWS token's signature and time/issuer/audience claims.
+func verifyJWT(token string, now time.Time) (jwtClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return jwtClaims{}, errors.New("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return jwtClaims{}, fmt.Errorf("header: %w", err)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return jwtClaims{}, fmt.Errorf("signature: %w", err)
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+
+	// Only accept algorithms matching the configured key type, never "none"
+	switch header.Alg {
+	case "HS256":
+		if len(jwtSecret) == 0 {
+			return jwtClaims{}, errors.New("HS256 tokens are not accepted")
+		}
+		mac := hmac.New(sha256.New, jwtSecret)
+		mac.Write(signed)
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return jwtClaims{}, errors.New("bad signature")
+		}
+	case "RS256", "ES256":
+		if jwtJWKSURL == "" {
+			return jwtClaims{}, fmt.Errorf("%s tokens are not accepted", header.Alg)
+		}
+		key, err := jwks.key(header.Kid, now)
+		if err != nil {
+			return jwtClaims{}, err
+		}
+		if err := verifyAsymmetric(header.Alg, key, signed, sig); err != nil {
+			return jwtClaims{}, err
+		}
+	default:
+		return jwtClaims{}, fmt.Errorf("unsupported alg %q", header.Alg)
+	}
+
+	var claims jwtClaims
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return jwtClaims{}, fmt.Errorf("claims: %w", err)
+	}
+
+	if claims.ExpiresAt == nil || now.After(time.Unix(*claims.ExpiresAt, 0).Add(jwtLeeway)) {
+		return jwtClaims{}, errors.New("token expired")
+	}
+	if claims.NotBefore != nil && now.Add(jwtLeeway).Before(time.Unix(*claims.NotBefore, 0)) {
+		return jwtClaims{}, errors.New("token not yet valid")
+	}
+	if jwtIssuer != "" && claims.Issuer != jwtIssuer {
+		return jwtClaims{}, fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	}
+	if jwtAudience != "" && !claims.hasAudience(jwtAudience) {
+		return jwtClaims{}, errors.New("audience mismatch")
+	}
+
+	return claims, nil
+}
+
+// decodeJWTPart decodes one base64url JSON segment of a token into v.
+func decodeJWTPart(part string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// verifyAsymmetric checks an RS256 or ES256 signature with a JWKS key.
+func verifyAsymmetric(alg string, key crypto.PublicKey, signed, sig []byte) error {
+	digest := sha256.Sum256(signed)
+
+	switch alg {
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("key type does not match RS256")
+		}
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig); err != nil {
+			return errors.New("bad signature")
+		}
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(sig) != 64 {
+			return errors.New("key type does not match ES256")
+		}
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(pub, digest[:], r, s) {
+			return errors.New("bad signature")
+		}
+	}
+	return nil
+}
+
+// jwksRefreshInterval is how often the key set is refetched. An unknown kid
+// triggers an early refetch, at most once per jwksMinRefetch.
+const (
+	jwksRefreshInterval = 10 * time.Minute
+	jwksMinRefetch      = 30 * time.Second
+)
+
+// jwksCache holds the keys fetched from JWT_JWKS_URL, by kid. The fetch runs
+// without holding mu, so verification keeps going with the cached keys while
+// the IdP is slow; only callers needing a key that isn't cached wait for it.
+type jwksCache struct {
+	mu         sync.Mutex
+	keys       map[string]crypto.PublicKey
+	fetchedAt  time.Time
+	refreshing chan struct{} // Closed when the fetch in flight finishes; nil if none
+}
+
+var jwks = &jwksCache{}
+
+// jwksClient fetches the key set under the operator outbound policy.
+var jwksClient = newOutboundClient(outbound, 10*time.Second)
+
+// key returns the public key with the given kid, refreshing the set when stale
+// or missing. A stale key is returned at once while the refresh runs.
+func (c *jwksCache) key(kid string, now time.Time) (crypto.PublicKey, error) {
+	c.mu.Lock()
+	key, ok := c.keys[kid]
+	stale := now.Sub(c.fetchedAt) > jwksRefreshInterval
+	if ok && !stale {
+		c.mu.Unlock()
+		return key, nil
+	}
+
+	if c.refreshing == nil && (stale || now.Sub(c.fetchedAt) > jwksMinRefetch) {
+		c.fetchedAt = now
+		c.refreshing = make(chan struct{})
+		go c.refresh(c.refreshing)
+	}
+	wait := c.refreshing
+	c.mu.Unlock()
+
+	if ok {
+		return key, nil
+	}
+	if wait != nil {
+		<-wait // Bounded by jwksClient's timeout
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if key, ok := c.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+// refresh fetches the key set and swaps it in, then closes done.
+func (c *jwksCache) refresh(done chan struct{}) {
+	keys, err := fetchJWKS()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		// Keep serving with the keys we have if the IdP is briefly down
+		slog.Error("Error refreshing JWKS", "err", err)
+	} else {
+		c.keys = keys
+	}
+	c.refreshing = nil
+	close(done)
+}
+
+// fetchJWKS fetches and parses the key set.
+func fetchJWKS() (map[string]crypto.PublicKey, error) {
+	resp, err := jwksClient.Get(jwtJWKSURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("JWKS endpoint returned status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		switch k.Kty {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(k.N)
+			e, errE := base64.RawURLEncoding.DecodeString(k.E)
+			if errN != nil || errE != nil {
+				continue
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			if k.Crv != "P-256" {
+				continue
+			}
+			x, errX := base64.RawURLEncoding.DecodeString(k.X)
+			y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+			if errX != nil || errY != nil {
+				continue
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		}
+	}
+
+	return keys, nil
+}
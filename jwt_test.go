@@ -0,0 +1,207 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// makeJWT encodes header and claims and signs them with sign.
+func makeJWT(t *testing.T, header, claims map[string]any, sign func(signed []byte) []byte) string {
+	t.Helper()
+
+	part := func(v any) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	signed := part(header) + "." + part(claims)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signed)))
+}
+
+func TestVerifyJWT(t *testing.T) {
+	savedSecret, savedAudience, savedIssuer, savedJWKS := jwtSecret, jwtAudience, jwtIssuer, jwtJWKSURL
+	t.Cleanup(func() {
+		jwtSecret, jwtAudience, jwtIssuer, jwtJWKSURL = savedSecret, savedAudience, savedIssuer, savedJWKS
+	})
+	jwtSecret = []byte("s3cret")
+	jwtAudience = "gig-api"
+	jwtIssuer = "https://idp.example.com"
+	jwtJWKSURL = ""
+
+	hs256 := func(secret string) func([]byte) []byte {
+		return func(signed []byte) []byte {
+			mac := hmac.New(sha256.New, []byte(secret))
+			mac.Write(signed)
+			return mac.Sum(nil)
+		}
+	}
+	noSig := func([]byte) []byte { return nil }
+
+	now := time.Now()
+	claims := func(edit func(map[string]any)) map[string]any {
+		c := map[string]any{
+			"email": "s@b.co",
+			"role":  RoleSupplier,
+			"iss":   "https://idp.example.com",
+			"aud":   "gig-api",
+			"exp":   now.Add(time.Hour).Unix(),
+		}
+		if edit != nil {
+			edit(c)
+		}
+		return c
+	}
+	hs := map[string]any{"alg": "HS256", "typ": "JWT"}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{name: "valid", token: makeJWT(t, hs, claims(nil), hs256("s3cret"))},
+		{name: "audience in a list", token: makeJWT(t, hs, claims(func(c map[string]any) { c["aud"] = []string{"other", "gig-api"} }), hs256("s3cret"))},
+		{name: "exp within leeway", token: makeJWT(t, hs, claims(func(c map[string]any) { c["exp"] = now.Add(-jwtLeeway / 2).Unix() }), hs256("s3cret"))},
+
+		{name: "alg none", token: makeJWT(t, map[string]any{"alg": "none"}, claims(nil), noSig), wantErr: "unsupported alg"},
+		{name: "alg HS512", token: makeJWT(t, map[string]any{"alg": "HS512"}, claims(nil), hs256("s3cret")), wantErr: "unsupported alg"},
+		{name: "RS256 without a JWKS", token: makeJWT(t, map[string]any{"alg": "RS256"}, claims(nil), hs256("s3cret")), wantErr: "not accepted"},
+		{name: "wrong secret", token: makeJWT(t, hs, claims(nil), hs256("guess")), wantErr: "bad signature"},
+		{name: "claims changed after signing", token: func() string {
+			tok := makeJWT(t, hs, claims(nil), hs256("s3cret"))
+			parts := strings.Split(tok, ".")
+			admin, _ := json.Marshal(claims(func(c map[string]any) { c["role"] = RoleAdmin }))
+			return parts[0] + "." + base64.RawURLEncoding.EncodeToString(admin) + "." + parts[2]
+		}(), wantErr: "bad signature"},
+		{name: "expired", token: makeJWT(t, hs, claims(func(c map[string]any) { c["exp"] = now.Add(-time.Hour).Unix() }), hs256("s3cret")), wantErr: "expired"},
+		{name: "no exp", token: makeJWT(t, hs, claims(func(c map[string]any) { delete(c, "exp") }), hs256("s3cret")), wantErr: "expired"},
+		{name: "not yet valid", token: makeJWT(t, hs, claims(func(c map[string]any) { c["nbf"] = now.Add(time.Hour).Unix() }), hs256("s3cret")), wantErr: "not yet valid"},
+		{name: "wrong audience", token: makeJWT(t, hs, claims(func(c map[string]any) { c["aud"] = "other-api" }), hs256("s3cret")), wantErr: "audience"},
+		{name: "no audience", token: makeJWT(t, hs, claims(func(c map[string]any) { delete(c, "aud") }), hs256("s3cret")), wantErr: "audience"},
+		{name: "wrong issuer", token: makeJWT(t, hs, claims(func(c map[string]any) { c["iss"] = "https://evil.example.com" }), hs256("s3cret")), wantErr: "issuer"},
+		{name: "malformed", token: "a.b", wantErr: "malformed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := verifyJWT(tt.token, now)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyJWTWithJWKS(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "EC", "kid": "k1", "use": "sig", "crv": "P-256",
+			"x": base64.RawURLEncoding.EncodeToString(priv.X.FillBytes(make([]byte, 32))),
+			"y": base64.RawURLEncoding.EncodeToString(priv.Y.FillBytes(make([]byte, 32))),
+		}}})
+	}))
+	defer srv.Close()
+
+	savedSecret, savedAudience, savedIssuer, savedJWKS := jwtSecret, jwtAudience, jwtIssuer, jwtJWKSURL
+	savedCache, savedClient := jwks, jwksClient
+	t.Cleanup(func() {
+		jwtSecret, jwtAudience, jwtIssuer, jwtJWKSURL = savedSecret, savedAudience, savedIssuer, savedJWKS
+		jwks, jwksClient = savedCache, savedClient
+	})
+	jwtSecret, jwtAudience, jwtIssuer, jwtJWKSURL = nil, "", "", srv.URL
+	jwks, jwksClient = &jwksCache{}, srv.Client() // The test server is on loopback, which the outbound policy blocks
+
+	es256 := func(signed []byte) []byte {
+		digest := sha256.Sum256(signed)
+		r, s, err := ecdsa.Sign(rand.Reader, priv, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+
+	now := time.Now()
+	claims := map[string]any{"email": "s@b.co", "role": RoleSupplier, "exp": now.Add(time.Hour).Unix()}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{name: "ES256", token: makeJWT(t, map[string]any{"alg": "ES256", "kid": "k1"}, claims, es256)},
+		{name: "unknown kid", token: makeJWT(t, map[string]any{"alg": "ES256", "kid": "k2"}, claims, es256), wantErr: "unknown key id"},
+		{name: "HS256 when only a JWKS is configured", token: makeJWT(t, map[string]any{"alg": "HS256", "kid": "k1"}, claims, func([]byte) []byte { return []byte("x") }), wantErr: "not accepted"},
+		{name: "signed by someone else", token: makeJWT(t, map[string]any{"alg": "ES256", "kid": "k1"}, claims, func(signed []byte) []byte {
+			other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			digest := sha256.Sum256(signed)
+			r, s, _ := ecdsa.Sign(rand.Reader, other, digest[:])
+			return append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+		}), wantErr: "bad signature"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := verifyJWT(tt.token, now)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	// The unknown kid may refetch once; cached keys must not refetch at all
+	before := fetches.Load()
+	if _, err := jwks.key("k1", now); err != nil {
+		t.Fatal(err)
+	}
+	if got := fetches.Load(); got != before {
+		t.Errorf("cached key triggered %d fetches", got-before)
+	}
+
+	// A stale key is served at once while the refresh runs in the background
+	jwks.mu.Lock()
+	jwks.fetchedAt = now.Add(-2 * jwksRefreshInterval)
+	jwks.mu.Unlock()
+	var key crypto.PublicKey
+	if key, err = jwks.key("k1", now); err != nil || key == nil {
+		t.Fatalf("stale key = %v, %v; want the cached key", key, err)
+	}
+	jwks.mu.Lock()
+	refreshing := jwks.refreshing
+	jwks.mu.Unlock()
+	if refreshing == nil {
+		t.Fatal("stale key did not start a refresh")
+	}
+	<-refreshing
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// --- Structured Logging ---
+
+// setupLogging makes a JSON slog logger the default, at the level named by
+// LOG_LEVEL (debug, info, warn or error; default info). The standard log
+// package is routed through it too, so library messages come out as JSON.
+func setupLogging() {
+	level := slog.LevelInfo
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		if err := level.UnmarshalText([]byte(strings.ToUpper(v))); err != nil {
+			defer slog.Warn("Ignoring invalid LOG_LEVEL", "value", v)
+		}
+	}
+
+	handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level})
+	slog.SetDefault(slog.New(requestIDHandler{handler}))
+}
+
+// requestIDHandler adds the request ID to every record logged with a request's context.
+type requestIDHandler struct {
+	slog.Handler
+}
+
+func (h requestIDHandler) Handle(ctx context.Context, rec slog.Record) error {
+	if id := requestIDFromContext(ctx); id != "" {
+		rec.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, rec)
+}
+
+func (h requestIDHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestIDHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h requestIDHandler) WithGroup(name string) slog.Handler {
+	return requestIDHandler{h.Handler.WithGroup(name)}
+}
+
+// fatal logs at error level and exits, like log.Fatalf.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// --- Request IDs ---
+
+type requestIDKey struct{}
+
+// requestIDFromContext returns the ID assigned by RequestLogHandler, or "".
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// maxRequestIDLength bounds IDs accepted from callers.
+const maxRequestIDLength = 128
+
+// validRequestID reports whether a caller-supplied ID is safe to log and echo:
+// short, and limited to letters, digits and -_.:
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-' || c == '_' || c == '.' || c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random 128-bit ID in hex.
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// RequestLogHandler assigns each request an ID, honoring a well-formed incoming
+// X-Request-ID, echoes it back, and logs one line per request with its outcome
+// and latency. Everything logged with the request's context carries the ID.
+// A WebSocket connection logs how long it was open as connection_ms instead,
+// so it doesn't read as a slow request.
+func RequestLogHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		r = r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		level := slog.LevelInfo
+		if rec.status >= 500 {
+			level = slog.LevelError
+		}
+		durationKey := "duration_ms"
+		if rec.hijacked {
+			durationKey = "connection_ms"
+		}
+		slog.Log(r.Context(), level, "Request handled",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			durationKey, float64(time.Since(start).Microseconds())/1000,
+		)
+	})
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+)
+
+// --- Email Notifications ---
+
+// Suppliers are emailed when a request is created for them. Mail goes out
+// through SendGrid when SENDGRID_API_KEY is set, otherwise through SMTP when
+// SMTP_HOST is set; with neither, notifications are off.
+//
+//	MAIL_FROM                          sender address (required to send)
+//	SENDGRID_API_KEY                   SendGrid v3 API key
+//	SMTP_HOST / SMTP_PORT              relay; port defaults to 587 (STARTTLS is used when offered)
+//	SMTP_USERNAME / SMTP_PASSWORD      optional PLAIN auth
+//
+// Emails are queued and sent by a background worker, so creating a request
+// never waits on the mail provider. Both providers are reached under the
+// outbound policy; an SMTP relay is tunnelled through HTTPS_PROXY when set.
+
+//go:embed templates/new_request.txt templates/new_request.html
+var mailTemplates embed.FS
+
+var (
+	newRequestText = texttemplate.Must(texttemplate.ParseFS(mailTemplates, "templates/new_request.txt"))
+	newRequestHTML = htmltemplate.Must(htmltemplate.ParseFS(mailTemplates, "templates/new_request.html"))
+)
+
+const (
+	mailQueueSize   = 256
+	mailSendTimeout = 30 * time.Second
+	sendGridURL     = "https://api.sendgrid.com/v3/mail/send"
+)
+
+// email is one rendered message.
+type email struct {
+	To, Subject, Text, HTML string
+}
+
+// mailSender delivers a rendered email through one provider.
+type mailSender interface {
+	Send(ctx context.Context, from string, msg email) error
+}
+
+// mailer renders notification emails and sends them from a background queue.
+type mailer struct {
+	provider string // "sendgrid", "smtp" or "" when disabled
+	from     string
+	sender   mailSender
+	queue    chan email
+	done     chan struct{}
+
+	mu     sync.Mutex // Guards closed, so nothing sends on queue once it is closed
+	closed bool
+}
+
+// notifications sends notification emails. It is set up in main.
+var notifications *mailer
+
+// newMailer picks a provider from the environment and starts the send worker.
+func newMailer() *mailer {
+	m := &mailer{from: os.Getenv("MAIL_FROM")}
+
+	switch {
+	case os.Getenv("SENDGRID_API_KEY") != "":
+		m.provider = "sendgrid"
+		m.sender = &sendGridSender{apiKey: os.Getenv("SENDGRID_API_KEY"), client: newOutboundClient(outbound, mailSendTimeout)}
+	case os.Getenv("SMTP_HOST") != "":
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		m.provider = "smtp"
+		m.sender = &smtpSender{
+			addr:     net.JoinHostPort(os.Getenv("SMTP_HOST"), port),
+			host:     os.Getenv("SMTP_HOST"),
+			username: os.Getenv("SMTP_USERNAME"),
+			password: os.Getenv("SMTP_PASSWORD"),
+		}
+	}
+
+	if m.provider != "" && m.from == "" {
+		slog.Warn("MAIL_FROM is not set; email notifications are disabled", "provider", m.provider)
+		m.provider, m.sender = "", nil
+	}
+	if m.provider == "" {
+		return m
+	}
+
+	m.queue = make(chan email, mailQueueSize)
+	m.done = make(chan struct{})
+	go m.run()
+
+	return m
+}
+
+// enabled reports whether notifications are sent at all.
+func (m *mailer) enabled() bool {
+	return m != nil && m.provider != ""
+}
+
+// NotifyNewRequest queues the new-request email to the request's supplier.
+func (m *mailer) NotifyNewRequest(ctx context.Context, req Request) {
+	if !m.enabled() {
+		return
+	}
+
+	msg, err := renderNewRequestEmail(req)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error rendering notification email", "id", req.ID, "err", err)
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		slog.WarnContext(ctx, "Shutting down; dropping notification email", "id", req.ID, "to", req.SupplierEmail)
+		return
+	}
+	select {
+	case m.queue <- msg:
+	default:
+		slog.ErrorContext(ctx, "Email queue full; dropping notification", "id", req.ID, "to", req.SupplierEmail)
+	}
+}
+
+// renderNewRequestEmail builds the plain text and HTML versions of the new-request email.
+func renderNewRequestEmail(req Request) (email, error) {
+	if err := renderDetails(&req); err != nil {
+		return email{}, err
+	}
+
+	var text, html bytes.Buffer
+	if err := newRequestText.Execute(&text, req); err != nil {
+		return email{}, err
+	}
+	// DetailsHTML is already sanitized, so it is inserted as-is
+	data := struct {
+		Request
+		DetailsHTML htmltemplate.HTML
+	}{req, htmltemplate.HTML(req.DetailsHTML)}
+	if err := newRequestHTML.Execute(&html, data); err != nil {
+		return email{}, err
+	}
+
+	return email{
+		To:      req.SupplierEmail,
+		Subject: "New gig request: " + req.GigTitle,
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
+
+// run sends queued emails one at a time until the queue is closed.
+func (m *mailer) run() {
+	defer close(m.done)
+
+	for msg := range m.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), mailSendTimeout)
+		err := m.sender.Send(ctx, m.from, msg)
+		cancel()
+
+		if err != nil {
+			slog.Error("Error sending notification email", "provider", m.provider, "to", msg.To, "err", err)
+			continue
+		}
+		slog.Info("Notification email sent", "provider", m.provider, "to", msg.To)
+	}
+}
+
+// Shutdown stops taking new emails and waits for the queue to drain, up to
+// ctx's deadline. Emails for requests created after this are dropped.
+func (m *mailer) Shutdown(ctx context.Context) error {
+	if !m.enabled() {
+		return nil
+	}
+
+	m.mu.Lock()
+	if !m.closed {
+		m.closed = true
+		close(m.queue)
+	}
+	m.mu.Unlock()
+
+	select {
+	case <-m.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// sendGridSender sends through the SendGrid v3 mail API.
+type sendGridSender struct {
+	apiKey string
+	client *http.Client
+}
+
+func (s *sendGridSender) Send(ctx context.Context, from string, msg email) error {
+	type address struct {
+		Email string `json:"email"`
+	}
+	type content struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	}
+	body, err := json.Marshal(map[string]any{
+		"personalizations": []map[string]any{{"to": []address{{msg.To}}}},
+		"from":             address{from},
+		"subject":          msg.Subject,
+		// SendGrid requires text/plain to come first
+		"content": []content{{"text/plain", msg.Text}, {"text/html", msg.HTML}},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", sendGridURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("sendgrid returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// smtpSender sends through an SMTP relay as a multipart/alternative message.
+type smtpSender struct {
+	addr, host         string
+	username, password string
+}
+
+func (s *smtpSender) Send(ctx context.Context, from string, msg email) error {
+	raw, err := buildMIMEMessage(from, msg)
+	if err != nil {
+		return err
+	}
+
+	// Dialled like every other outbound call, so the proxy and destination policy apply
+	conn, err := outbound.dial(ctx, s.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// net/smtp has no context support, so ctx bounds the session through the
+	// connection: its deadline, and closing it if ctx is cancelled first
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	err = s.deliver(conn, from, msg.To, raw)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// deliver runs an SMTP session over conn, as smtp.SendMail does over its own connection.
+func (s *smtpSender) deliver(conn net.Conn, from, to string, raw []byte) error {
+	c, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: s.host}); err != nil {
+			return err
+		}
+	}
+	if s.username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.username, s.password, s.host)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(raw); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// buildMIMEMessage renders msg as an RFC 5322 message with text and HTML alternatives.
+func buildMIMEMessage(from string, msg email) ([]byte, error) {
+	if strings.ContainsAny(from+msg.To, "\r\n") {
+		return nil, errors.New("invalid address")
+	}
+
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "From: %s\r\n", from)
+	fmt.Fprintf(&out, "To: %s\r\n", msg.To)
+	// Q-encoding also neutralizes any line breaks in the user-supplied title
+	fmt.Fprintf(&out, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&out, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&out, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&out, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", parts.Boundary())
+	out.Write(body.Bytes())
+
+	return out.Bytes(), nil
+}
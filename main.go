@@ -1,37 +1,62 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
-	"log"
+	"errors"
+	"io"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"os" // Necessary for reading the PORT environment variable
+	"os/signal"
+	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
+	"unicode/utf8"
 )
 
 // --- 1. Data Structure ---
 
 // Request represents a single user gig request, now including the supplier's email for filtering.
 type Request struct {
-	ID            int       `json:"id"`
-	GigTitle      string    `json:"gig_title"`
-	Client        string    `json:"client"`
-	ClientEmail   string    `json:"client_email"` // The client's email for contact
-	SupplierEmail string    `json:"supplier_email"` // The supplier/user who owns this request
-	Details       string    `json:"details"`
-	CreatedAt     time.Time `json:"created_at"`
+	ID            int        `json:"id"`
+	GigTitle      string     `json:"gig_title"`
+	Client        string     `json:"client"`
+	ClientEmail   string     `json:"client_email"`           // The client's email for contact
+	SupplierEmail string     `json:"supplier_email"`         // The supplier/user who owns this request
+	Details       string     `json:"details"`                // Markdown
+	DetailsHTML   string     `json:"details_html,omitempty"` // Rendered details, only on reads with ?render=html; never stored
+	Status        Status     `json:"status"`                 // Lifecycle state; only changed via POST /requests/{id}/status
+	Consent       *Consent   `json:"consent,omitempty"`      // Terms acceptance, when the client gave it
+	CreatedAt     time.Time  `json:"created_at"`
+	DeletedAt     *time.Time `json:"deleted_at,omitempty"` // Set when the request is soft-deleted
 }
 
-// --- 2. Global State Management ---
+// maxRequestBodyBytes caps the size of a POST /requests body so a malformed or
+// hostile payload can't make the decoder allocate without bound.
+const maxRequestBodyBytes = 64 << 10
+
+// Page sizes for GET /requests: the default when no limit is given, and the cap.
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
 
-// Thread-safe store for all requests. (In-Memory Database)
-var (
-	requests = []Request{}
-	mu       sync.Mutex // Mutex to protect the requests slice from concurrent access
-	nextID   = 1
+// Length limits for request text fields, counted in characters.
+const (
+	maxGigTitleLength = 200
+	maxClientLength   = 200
+	maxDetailsLength  = 5000
 )
 
+// --- 2. Global State Management ---
+
+// store holds all requests. It is set up in main before the server starts.
+var store Store
+
 // --- 3. Handlers ---
 
 // RequestsHandler handles GET (list all) and POST (create new) requests to /requests.
@@ -42,40 +67,243 @@ func RequestsHandler(w http.ResponseWriter, r *http.Request) {
 	case "POST":
 		createRequest(w, r)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// RequestHandler handles requests to a single gig request at /requests/{id}
+// and its subresources, such as /requests/{id}/status.
+func RequestHandler(w http.ResponseWriter, r *http.Request) {
+	id, sub, ok := parseRequestPath(r.URL.Path)
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "Request not found")
+		return
+	}
+
+	switch sub {
+	case "":
+	case "status":
+		changeRequestStatus(w, r, id)
+		return
+	default:
+		writeError(w, r, http.StatusNotFound, "Not found")
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		getRequest(w, r, id)
+	case "PUT":
+		replaceRequest(w, r, id)
+	case "PATCH":
+		patchRequest(w, r, id)
+	case "DELETE":
+		deleteRequest(w, r, id)
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
-// listRequests returns all stored gig requests, optionally filtered by supplier_email query param.
+// parseRequestPath splits a /requests/{id}[/{sub}] path into the numeric ID and
+// the optional subresource name.
+func parseRequestPath(path string) (int, string, bool) {
+	idPart, sub, _ := strings.Cut(strings.TrimPrefix(path, "/requests/"), "/")
+
+	id, err := strconv.Atoi(idPart)
+	if err != nil || id <= 0 || strings.Contains(sub, "/") {
+		return 0, "", false
+	}
+	return id, sub, true
+}
+
+// listRequests returns a page of stored gig requests, optionally filtered by the supplier_email,
+// client_email, status, created_after, created_before and q (text search) query params, combined with AND.
+// The total number of matching requests is reported in the X-Total-Count header.
 func listRequests(w http.ResponseWriter, r *http.Request) {
-	// 1. Get the supplier_email from the query parameters
-	query := r.URL.Query()
-	supplierEmailFilter := query.Get("supplier_email")
+	renderHTML, ok := parseRenderParam(w, r)
+	if !ok {
+		return
+	}
 
-	// Lock the data before reading to ensure thread safety
-	mu.Lock()
-	defer mu.Unlock()
+	filter, ok := parseListFilter(w, r, true)
+	if !ok {
+		return
+	}
 
-	var filteredRequests []Request
+	// Ask the store for the matching requests; an empty filter returns all (e.g., for an admin view)
+	filteredRequests, total, err := store.List(r.Context(), filter)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error listing requests", "err", err)
+		writeError(w, r, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
 
-	// 2. Filter the requests slice if a supplier_email is provided
-	if supplierEmailFilter != "" {
-		for _, req := range requests {
-			if req.SupplierEmail == supplierEmailFilter {
-				filteredRequests = append(filteredRequests, req)
+	if renderHTML {
+		for i := range filteredRequests {
+			if err := renderDetails(&filteredRequests[i]); err != nil {
+				slog.ErrorContext(r.Context(), "Error rendering details", "id", filteredRequests[i].ID, "err", err)
+				writeError(w, r, http.StatusInternalServerError, "Internal Server Error")
+				return
 			}
 		}
-	} else {
-		// 3. If no filter is provided, return all requests (e.g., for an admin view)
-		filteredRequests = requests
 	}
 
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 
 	if err := json.NewEncoder(w).Encode(filteredRequests); err != nil {
-		log.Printf("Error encoding response: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Error encoding response", "err", err)
+		writeError(w, r, http.StatusInternalServerError, "Internal Server Error")
+	}
+}
+
+// parseListFilter reads the filter, paging and sorting query params shared by
+// GET /requests and the export, scoping suppliers and clients to their own
+// requests. Unless paged, a missing limit means all matches. On failure it
+// writes a 400 or 403 and returns false.
+func parseListFilter(w http.ResponseWriter, r *http.Request, paged bool) (ListFilter, bool) {
+	// 1. Get the filters from the query parameters
+	query := r.URL.Query()
+	supplierEmailFilter := normalizeEmail(query.Get("supplier_email"))
+	clientEmailFilter := normalizeEmail(query.Get("client_email"))
+	statusFilter := Status(query.Get("status"))
+	if statusFilter != "" && !validStatus(statusFilter) {
+		invalidParam(w, r, "status", "must be one of pending, accepted, declined, completed")
+		return ListFilter{}, false
+	}
+	caller := callerFromContext(r.Context())
+	// Deleted requests are kept for admins only; anyone else never sees them
+	includeDeleted := query.Get("include_deleted") == "true" && caller.isAdmin()
+
+	// Suppliers and clients only ever see their own requests
+	switch caller.Role {
+	case RoleSupplier:
+		if supplierEmailFilter != "" && supplierEmailFilter != caller.Email {
+			writeError(w, r, http.StatusForbidden, "Forbidden: credentials are scoped to "+caller.scope())
+			return ListFilter{}, false
+		}
+		supplierEmailFilter = caller.Email
+	case RoleClient:
+		if clientEmailFilter != "" && clientEmailFilter != caller.Email {
+			writeError(w, r, http.StatusForbidden, "Forbidden: credentials are scoped to "+caller.scope())
+			return ListFilter{}, false
+		}
+		clientEmailFilter = caller.Email
+	}
+
+	terms := searchTerms(query.Get("q"))
+	if len(terms) > maxSearchTerms {
+		invalidParam(w, r, "q", "at most "+strconv.Itoa(maxSearchTerms)+" search terms are allowed")
+		return ListFilter{}, false
+	}
+
+	createdAfter, ok := parseTimeParam(w, r, query, "created_after")
+	if !ok {
+		return ListFilter{}, false
+	}
+	createdBefore, ok := parseTimeParam(w, r, query, "created_before")
+	if !ok {
+		return ListFilter{}, false
+	}
+
+	// 2. Parse paging parameters, capping the page size when paged
+	limit := 0
+	if paged {
+		limit = defaultPageSize
+	}
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			invalidParam(w, r, "limit", "must be a positive integer")
+			return ListFilter{}, false
+		}
+		limit = n
+		if paged {
+			limit = min(n, maxPageSize)
+		}
+	}
+
+	offset := 0
+	if v := query.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			invalidParam(w, r, "offset", "must be a non-negative integer")
+			return ListFilter{}, false
+		}
+		offset = n
+	}
+
+	// 3. Parse sorting, e.g. ?sort=created_at&order=desc
+	sortBy := query.Get("sort")
+	if sortBy != "" && !validSortField(sortBy) {
+		invalidParam(w, r, "sort", "must be one of "+strings.Join(SortFields, ", "))
+		return ListFilter{}, false
+	}
+
+	order := query.Get("order")
+	if order != "" && order != "asc" && order != "desc" {
+		invalidParam(w, r, "order", "must be asc or desc")
+		return ListFilter{}, false
+	}
+
+	return ListFilter{
+		SupplierEmail:  supplierEmailFilter,
+		ClientEmail:    clientEmailFilter,
+		Status:         statusFilter,
+		CreatedAfter:   createdAfter,
+		CreatedBefore:  createdBefore,
+		IncludeDeleted: includeDeleted,
+		SearchTerms:    terms,
+		SortBy:         sortBy,
+		Descending:     order == "desc",
+		Limit:          limit,
+		Offset:         offset,
+	}, true
+}
+
+// parseTimeParam parses an optional RFC3339 query parameter, returning the zero
+// time if it is absent. On failure it writes a 400 and returns false.
+func parseTimeParam(w http.ResponseWriter, r *http.Request, query url.Values, name string) (time.Time, bool) {
+	v := query.Get(name)
+	if v == "" {
+		return time.Time{}, true
+	}
+
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		invalidParam(w, r, name, "must be RFC3339")
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// getRequest returns a single gig request by ID, or 404 if it doesn't exist.
+func getRequest(w http.ResponseWriter, r *http.Request, id int) {
+	renderHTML, ok := parseRenderParam(w, r)
+	if !ok {
+		return
+	}
+
+	includeDeleted := r.URL.Query().Get("include_deleted") == "true" && callerFromContext(r.Context()).isAdmin()
+	req, ok := loadRequest(w, r, id, includeDeleted)
+	if !ok {
+		return
+	}
+
+	if renderHTML {
+		if err := renderDetails(&req); err != nil {
+			slog.ErrorContext(r.Context(), "Error rendering details", "id", id, "err", err)
+			writeError(w, r, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(req); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding response", "err", err)
 	}
 }
 
@@ -83,58 +311,342 @@ func listRequests(w http.ResponseWriter, r *http.Request) {
 func createRequest(w http.ResponseWriter, r *http.Request) {
 	var newRequest Request
 
-	if err := json.NewDecoder(r.Body).Decode(&newRequest); err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+	if !decodeJSONBody(w, r, &newRequest) {
 		return
 	}
 
-	// Basic Validation - require all core fields including the new supplier_email
-	if newRequest.GigTitle == "" || newRequest.Client == "" || newRequest.ClientEmail == "" || newRequest.SupplierEmail == "" {
-		http.Error(w, "Missing required fields (gig_title, client, client_email, supplier_email)", http.StatusBadRequest)
+	// Scoped callers create requests for themselves unless told otherwise
+	caller := callerFromContext(r.Context())
+	if caller.Role == RoleSupplier && newRequest.SupplierEmail == "" {
+		newRequest.SupplierEmail = caller.Email
+	}
+	if caller.Role == RoleClient && newRequest.ClientEmail == "" {
+		newRequest.ClientEmail = caller.Email
+	}
+
+	// Normalize emails and require all core fields including the new supplier_email
+	if !validateRequest(w, r, &newRequest) {
 		return
 	}
 
-	// Assign ID and timestamp, and save it thread-safely
-	mu.Lock()
-	newRequest.ID = nextID
+	if !caller.canAccess(newRequest) {
+		writeError(w, r, http.StatusForbidden, "Forbidden: credentials are scoped to "+caller.scope())
+		return
+	}
+
+	// Record the client's terms acceptance and enforce it when required
+	if !checkConsent(&newRequest, r) {
+		writeAPIError(w, r, http.StatusBadRequest, APIError{
+			Code:    codeConsentRequired,
+			Message: "Consent to terms version " + termsVersion + " is required",
+			Details: map[string]string{"consent": "must accept terms version " + termsVersion},
+		})
+		return
+	}
+
+	// Every request starts out pending, whatever status the client sent
+	newRequest.Status = StatusPending
+
+	// Assign the timestamp and save it; the store assigns the ID
 	newRequest.CreatedAt = time.Now()
-	requests = append(requests, newRequest)
-	nextID++
-	mu.Unlock()
+	newRequest, err := store.Create(r.Context(), newRequest)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error creating request", "err", err)
+		writeError(w, r, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
 
-	log.Printf("New request created: ID %d, Title: %s, Supplier: %s", newRequest.ID, newRequest.GigTitle, newRequest.SupplierEmail)
+	slog.InfoContext(r.Context(), "New request created", "id", newRequest.ID, "title", newRequest.GigTitle, "supplier", newRequest.SupplierEmail)
+	publishRequestEvent(r.Context(), EventRequestCreated, newRequest)
+	if newRequest.Consent != nil {
+		slog.InfoContext(r.Context(), "Consent recorded", "id", newRequest.ID, "terms_version", newRequest.Consent.TermsVersion, "ip", newRequest.Consent.IP)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 
 	if err := json.NewEncoder(w).Encode(newRequest); err != nil {
-		log.Printf("Error encoding response: %v", err)
+		slog.ErrorContext(r.Context(), "Error encoding response", "err", err)
 	}
 }
 
-// CORSHandler wrapper to add necessary CORS headers.
-func CORSHandler(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+// decodeJSONBody decodes a size-limited JSON object from the request body into v.
+// On failure it writes a 400 and returns false.
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodyBytes)
+	decoder := json.NewDecoder(r.Body)
 
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
+	if err := decoder.Decode(v); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return false
+	}
+
+	// Reject trailing data after the JSON object (e.g. two concatenated objects,
+	// or a stray "}"), which More alone doesn't catch
+	if err := decoder.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		writeError(w, r, http.StatusBadRequest, "Invalid request body: unexpected data after JSON object")
+		return false
+	}
+
+	return true
+}
+
+// validateRequest trims and normalizes a request's fields, then checks each one.
+// On failure it writes a 400 listing every invalid field and returns false.
+func validateRequest(w http.ResponseWriter, r *http.Request, req *Request) bool {
+	if problems := requestProblems(req); len(problems) > 0 {
+		writeAPIError(w, r, http.StatusBadRequest, APIError{
+			Code:    codeValidationFailed,
+			Message: "Invalid request: see details for each field",
+			Details: problems,
+		})
+		return false
+	}
+
+	return true
+}
+
+// requestProblems normalizes req in place and returns what is wrong with each
+// invalid field, keyed by JSON name. It is empty when req is valid.
+func requestProblems(req *Request) map[string]string {
+	req.GigTitle = strings.TrimSpace(req.GigTitle)
+	req.Client = strings.TrimSpace(req.Client)
+	req.Details = strings.TrimSpace(req.Details)
+	req.DetailsHTML = "" // Output only; rendered on read
+
+	// Normalize emails so "Bob@X.com" and "bob@x.com" map to the same supplier
+	req.ClientEmail = normalizeEmail(req.ClientEmail)
+	req.SupplierEmail = normalizeEmail(req.SupplierEmail)
+
+	problems := map[string]string{}
+
+	checkText := func(field, value string, required bool, maxLen int) {
+		switch {
+		case value == "" && required:
+			problems[field] = "required"
+		case utf8.RuneCountInString(value) > maxLen:
+			problems[field] = "must be at most " + strconv.Itoa(maxLen) + " characters"
 		}
+	}
+	checkText("gig_title", req.GigTitle, true, maxGigTitleLength)
+	checkText("client", req.Client, true, maxClientLength)
+	checkText("details", req.Details, false, maxDetailsLength)
+
+	checkEmail := func(field, value string) {
+		switch {
+		case value == "":
+			problems[field] = "required"
+		case !validEmail(value):
+			problems[field] = "invalid email format"
+		}
+	}
+	checkEmail("client_email", req.ClientEmail)
+	checkEmail("supplier_email", req.SupplierEmail)
+
+	return problems
+}
+
+// deleteRequest handles DELETE /requests/{id}. Requests are soft-deleted: they are
+// stamped with DeletedAt and hidden from lists unless an admin asks for include_deleted=true.
+func deleteRequest(w http.ResponseWriter, r *http.Request, id int) {
+	req, ok := loadRequest(w, r, id, false)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	req.DeletedAt = &now
+
+	if _, err := store.Update(r.Context(), req); err != nil {
+		slog.ErrorContext(r.Context(), "Error deleting request", "id", id, "err", err)
+		writeError(w, r, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Request deleted", "id", id)
+	publishRequestEvent(r.Context(), EventRequestDeleted, req)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requestPatch holds the editable fields of a PATCH body; nil means "leave unchanged".
+// ID, Status, CreatedAt, Consent and DeletedAt are deliberately absent so a patch can't overwrite them.
+type requestPatch struct {
+	GigTitle      *string `json:"gig_title"`
+	Client        *string `json:"client"`
+	ClientEmail   *string `json:"client_email"`
+	SupplierEmail *string `json:"supplier_email"`
+	Details       *string `json:"details"`
+}
+
+// replaceRequest handles PUT /requests/{id}, replacing every editable field.
+// Immutable fields (id, status, created_at, consent, deleted_at) are kept from the stored record.
+func replaceRequest(w http.ResponseWriter, r *http.Request, id int) {
+	existing, ok := loadRequest(w, r, id, false)
+	if !ok {
+		return
+	}
+
+	var replacement Request
+	if !decodeJSONBody(w, r, &replacement) {
+		return
+	}
+
+	replacement.ID = existing.ID
+	replacement.CreatedAt = existing.CreatedAt
+	replacement.Consent = existing.Consent
+	replacement.Status = existing.Status
+	replacement.DeletedAt = existing.DeletedAt
+
+	saveUpdatedRequest(w, r, replacement)
+}
+
+// patchRequest handles PATCH /requests/{id}, changing only the fields present in the body.
+func patchRequest(w http.ResponseWriter, r *http.Request, id int) {
+	req, ok := loadRequest(w, r, id, false)
+	if !ok {
+		return
+	}
+
+	var patch requestPatch
+	if !decodeJSONBody(w, r, &patch) {
+		return
+	}
+
+	if patch.GigTitle != nil {
+		req.GigTitle = *patch.GigTitle
+	}
+	if patch.Client != nil {
+		req.Client = *patch.Client
+	}
+	if patch.ClientEmail != nil {
+		req.ClientEmail = *patch.ClientEmail
+	}
+	if patch.SupplierEmail != nil {
+		req.SupplierEmail = *patch.SupplierEmail
+	}
+	if patch.Details != nil {
+		req.Details = *patch.Details
+	}
+
+	saveUpdatedRequest(w, r, req)
+}
+
+// loadRequest fetches a request, writing a 404 or 500 and returning false if it
+// can't be loaded. Soft-deleted requests are treated as missing unless includeDeleted.
+func loadRequest(w http.ResponseWriter, r *http.Request, id int, includeDeleted bool) (Request, bool) {
+	req, err := store.Get(r.Context(), id)
+
+	// Requests outside the caller's scope are reported as missing, not forbidden, so IDs don't leak
+	hidden := err == nil && ((req.DeletedAt != nil && !includeDeleted) || !callerFromContext(r.Context()).canAccess(req))
+	if errors.Is(err, ErrNotFound) || hidden {
+		writeError(w, r, http.StatusNotFound, "Request not found")
+		return Request{}, false
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error fetching request", "id", id, "err", err)
+		writeError(w, r, http.StatusInternalServerError, "Internal Server Error")
+		return Request{}, false
+	}
+	return req, true
+}
+
+// saveUpdatedRequest validates and stores a modified request, then writes it back.
+func saveUpdatedRequest(w http.ResponseWriter, r *http.Request, req Request) {
+	if !validateRequest(w, r, &req) {
+		return
+	}
 
-		next(w, r)
+	if caller := callerFromContext(r.Context()); !caller.canAccess(req) {
+		writeError(w, r, http.StatusForbidden, "Forbidden: credentials are scoped to "+caller.scope())
+		return
+	}
+
+	req, err := store.Update(r.Context(), req)
+	if errors.Is(err, ErrNotFound) {
+		writeError(w, r, http.StatusNotFound, "Request not found")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error updating request", "id", req.ID, "err", err)
+		writeError(w, r, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Request updated", "id", req.ID, "title", req.GigTitle)
+	publishRequestEvent(r.Context(), EventRequestUpdated, req)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(req); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding response", "err", err)
 	}
 }
 
 // --- 4. Main Function and Router Setup ---
 
 func main() {
+	setupLogging()
+	cors = loadCORSPolicy()
+	rateLimit = loadRateLimiter()
+	trustedProxies = loadTrustedProxies()
+
+	// Consent can't be required without terms to consent to
+	if requireConsent && termsVersion == "" {
+		fatal("REQUIRE_CONSENT is set but TERMS_VERSION is empty")
+	}
+
+	// Pick the storage backend (Postgres when DATABASE_URL is set, otherwise in-memory)
+	var err error
+	store, err = openStore(context.Background())
+	if err != nil {
+		fatal("Failed to open store", "backend", storageBackend, "err", err)
+	}
+	slog.Info("Using storage backend", "backend", storageBackend)
+	keys = newKeyStore(store) // Needs the concrete store to share its database
+	webhooks = newWebhookStore(store)
+	dispatcher = newWebhookDispatcher()
+	notifications = newMailer()
+
+	registerMetrics(store)
+	store = instrumentedStore{store}
+
+	if !requireAPIKeys {
+		slog.Warn("REQUIRE_API_KEYS is not set; /requests is open to unauthenticated callers")
+	}
+
 	mux := http.NewServeMux()
 
 	// Register the handler with the CORS wrapper
-	mux.HandleFunc("/requests", CORSHandler(RequestsHandler))
+	mux.HandleFunc("/requests", CORSHandler(RateLimitHandler(RequestsHandler), "GET", "POST"))
+	mux.HandleFunc("/requests/", CORSHandler(RequestHandler, "GET", "POST", "PUT", "PATCH", "DELETE"))
+	mux.HandleFunc("/requests/export", CORSHandler(ExportRequestsHandler, "GET"))
+	mux.HandleFunc("/requests/import", CORSHandler(RateLimitHandler(ImportRequestsHandler), "POST"))
+	mux.HandleFunc("/version", CORSHandler(VersionHandler, "GET"))
+	mux.HandleFunc("/api-keys", CORSHandler(APIKeysHandler, "GET", "POST"))
+	mux.HandleFunc("/api-keys/", CORSHandler(APIKeyHandler, "DELETE"))
+	mux.HandleFunc("/admin/analytics/dataset", CORSHandler(AnalyticsDatasetHandler, "GET"))
+	mux.HandleFunc("/admin/analytics/heatmap", CORSHandler(AnalyticsHeatmapHandler, "GET"))
+	mux.HandleFunc("/webhooks", CORSHandler(WebhooksHandler, "GET", "POST"))
+	mux.HandleFunc("/webhooks/", CORSHandler(WebhookHandler, "GET", "PUT", "DELETE"))
+	mux.HandleFunc("/ws", WSHandler)
+	mux.HandleFunc("/openapi.json", CORSHandler(OpenAPIHandler, "GET"))
+	if docsUIEnabled {
+		if err := loadDocsPage(); err != nil {
+			fatal("Invalid DOCS_UI configuration", "err", err)
+		}
+		mux.HandleFunc("/docs", DocsHandler)
+	}
+	mux.Handle("/metrics", MetricsHandler)
+
+	if len(analyticsHashKey) == 0 {
+		slog.Warn("ANALYTICS_HASH_KEY is not set; /admin/analytics/dataset is disabled")
+	}
+
+	// Watch traffic for sharp deviations from the rolling baseline
+	detector := newAnomalyDetector()
+	go detector.Run()
 
 	// Get the PORT from the environment variable (Render sets this)
 	port := os.Getenv("PORT")
@@ -145,9 +657,92 @@ func main() {
 	// Go's ListenAndServe requires the port to be prefixed with a colon (e.g., :8080)
 	listenAddr := ":" + port
 
-	fmt.Printf("API server starting on %s\n", listenAddr)
+	// Load partner keys for verifying signed POSTs (RFC 9421)
+	if err := loadPartnerKeys(); err != nil {
+		fatal("Failed to load partner keys", "err", err)
+	}
 
-	if err := http.ListenAndServe(listenAddr, mux); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+	handler := RequestLogHandler(MetricsMiddleware(mux, VersionHeaderHandler(detector.Middleware(SignatureHandler(AuthHandler(mux))))))
+
+	// Stop on SIGINT/SIGTERM (Render sends SIGTERM before a restart)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	server := &http.Server{Addr: listenAddr, Handler: handler}
+	server.RegisterOnShutdown(hub.Shutdown)
+	servers := []*http.Server{server}
+
+	// Optionally serve the same routes to internal callers over mutual TLS on a separate port
+	mtlsCfg, err := loadMTLSConfig()
+	if err != nil {
+		fatal("Invalid mTLS configuration", "err", err)
+	}
+	if mtlsCfg.Port != "" {
+		mtlsServer, err := newMTLSServer(mtlsCfg, handler)
+		if err != nil {
+			fatal("mTLS server failed", "err", err)
+		}
+		servers = append(servers, mtlsServer)
+
+		slog.Info("mTLS server starting", "addr", mtlsServer.Addr)
+		go func() {
+			if err := mtlsServer.ListenAndServeTLS(mtlsCfg.CertFile, mtlsCfg.KeyFile); err != http.ErrServerClosed {
+				fatal("mTLS server failed", "err", err)
+			}
+		}()
 	}
+
+	slog.Info("API server starting", "addr", listenAddr)
+	go func() {
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			fatal("Server failed to start", "err", err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop() // A second signal kills the process immediately
+
+	shutdown(servers)
+}
+
+// shutdown stops accepting connections, waits up to SHUTDOWN_TIMEOUT (default 20s)
+// for in-flight requests to finish, then closes the store.
+func shutdown(servers []*http.Server) {
+	timeout := 20 * time.Second
+	if v, err := time.ParseDuration(os.Getenv("SHUTDOWN_TIMEOUT")); err == nil && v > 0 {
+		timeout = v
+	}
+	slog.Info("Shutting down; draining in-flight requests", "timeout", timeout.String())
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, srv := range servers {
+		wg.Add(1)
+		go func(srv *http.Server) {
+			defer wg.Done()
+			if err := srv.Shutdown(ctx); err != nil {
+				slog.Error("Error draining server", "addr", srv.Addr, "err", err)
+			}
+		}(srv)
+	}
+	wg.Wait()
+
+	// In-flight webhook sends share the same deadline; queued retries are dropped
+	if err := dispatcher.Shutdown(ctx); err != nil {
+		slog.Error("Error stopping webhook dispatcher", "err", err)
+	}
+	if err := notifications.Shutdown(ctx); err != nil {
+		slog.Error("Error flushing notification emails", "err", err)
+	}
+
+	// Close the store last, after in-flight writes have had their chance to land
+	if closer, ok := store.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			slog.Error("Error closing store", "backend", storageBackend, "err", err)
+		}
+	}
+
+	slog.Info("Shutdown complete")
 }
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func FuzzDecodeJSONBody(f *testing.F) {
+	for _, seed := range []string{
+		`{"gig_title":"g","client":"c","client_email":"a@b.co","supplier_email":"s@b.co"}`,
+		`{"a":1}`,
+		`{"a":1}}`,
+		`{"a":1}{"a":2}`,
+		`{"a":1} `,
+		`[]`,
+		`null`,
+		`"`,
+		``,
+	} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		r := httptest.NewRequest("POST", "/requests", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+
+		var v map[string]any
+		if decodeJSONBody(w, r, &v) {
+			// Accepted bodies are exactly one JSON value, within the size cap
+			if !json.Valid(body) {
+				t.Fatalf("accepted invalid or trailing JSON %q", body)
+			}
+			if len(body) > maxRequestBodyBytes {
+				t.Fatalf("accepted %d bytes, over the %d byte cap", len(body), maxRequestBodyBytes)
+			}
+			return
+		}
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("rejected body %q with status %d, want 400", body, w.Code)
+		}
+	})
+}
+
+func FuzzParseListFilter(f *testing.F) {
+	for _, seed := range []string{
+		"",
+		"supplier_email=s@b.co&status=pending",
+		"limit=0",
+		"limit=-1&offset=-1",
+		"limit=99999999999999999999",
+		"offset=9223372036854775807",
+		"sort=created_at&order=desc",
+		"sort=;drop&order=sideways",
+		"created_after=2024-01-01T00:00:00Z&created_before=nope",
+		"q=a+b+c+d+e+f+g+h+i+j+k+l",
+		"client_email=%ff%fe",
+		"status=&status=accepted",
+	} {
+		f.Add(seed, RoleAdmin, false)
+		f.Add(seed, RoleSupplier, true)
+	}
+
+	f.Fuzz(func(t *testing.T, rawQuery, role string, paged bool) {
+		caller := Caller{Role: role}
+		switch role {
+		case RoleSupplier, RoleClient:
+			caller.Email = "me@b.co"
+		}
+
+		r := httptest.NewRequest("GET", "/requests", nil)
+		r.URL.RawQuery = rawQuery
+		r = r.WithContext(context.WithValue(r.Context(), callerKey{}, caller))
+		w := httptest.NewRecorder()
+
+		filter, ok := parseListFilter(w, r, paged)
+		if !ok {
+			if w.Code != http.StatusBadRequest && w.Code != http.StatusForbidden {
+				t.Fatalf("rejected %q with status %d, want 400 or 403", rawQuery, w.Code)
+			}
+			return
+		}
+
+		if filter.Limit < 0 || filter.Offset < 0 {
+			t.Fatalf("negative paging from %q: limit %d, offset %d", rawQuery, filter.Limit, filter.Offset)
+		}
+		if paged && (filter.Limit < 1 || filter.Limit > maxPageSize) {
+			t.Fatalf("paged limit %d from %q is outside 1..%d", filter.Limit, rawQuery, maxPageSize)
+		}
+		if len(filter.SearchTerms) > maxSearchTerms {
+			t.Fatalf("%d search terms from %q, over the cap of %d", len(filter.SearchTerms), rawQuery, maxSearchTerms)
+		}
+		if role == RoleSupplier && filter.SupplierEmail != caller.Email {
+			t.Fatalf("supplier filter escaped its scope: %q", filter.SupplierEmail)
+		}
+		if role == RoleClient && filter.ClientEmail != caller.Email {
+			t.Fatalf("client filter escaped its scope: %q", filter.ClientEmail)
+		}
+	})
+}
+
+// serve sends one request to handler as caller and returns the response.
+func serve(handler http.HandlerFunc, caller Caller, method, target, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r = r.WithContext(context.WithValue(r.Context(), callerKey{}, caller))
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func TestUpdateRequest(t *testing.T) {
+	admin := Caller{Role: RoleAdmin}
+	supplier := Caller{Role: RoleSupplier, Email: "s@b.co"}
+
+	tests := []struct {
+		name       string
+		caller     Caller
+		method     string
+		body       string
+		wantStatus int
+		wantTitle  string
+		wantClient string
+	}{
+		{name: "put replaces every field", caller: admin, method: "PUT", wantStatus: http.StatusOK, wantTitle: "New", wantClient: "Other",
+			body: `{"gig_title":"New","client":"Other","client_email":"c@b.co","supplier_email":"s@b.co"}`},
+		{name: "put without a required field", caller: admin, method: "PUT", wantStatus: http.StatusBadRequest,
+			body: `{"gig_title":"New","client_email":"c@b.co","supplier_email":"s@b.co"}`},
+		{name: "put can't change status", caller: admin, method: "PUT", wantStatus: http.StatusOK, wantTitle: "New", wantClient: "Other",
+			body: `{"gig_title":"New","client":"Other","client_email":"c@b.co","supplier_email":"s@b.co","status":"completed"}`},
+		{name: "patch keeps absent fields", caller: admin, method: "PATCH", body: `{"gig_title":"Fixed"}`,
+			wantStatus: http.StatusOK, wantTitle: "Fixed", wantClient: "Client"},
+		{name: "patch to an invalid email", caller: admin, method: "PATCH", body: `{"client_email":"nope"}`, wantStatus: http.StatusBadRequest},
+		{name: "patch hands the request to another supplier", caller: supplier, method: "PATCH", body: `{"supplier_email":"x@b.co"}`,
+			wantStatus: http.StatusForbidden},
+		{name: "patch someone else's request", caller: Caller{Role: RoleSupplier, Email: "x@b.co"}, method: "PATCH",
+			body: `{"gig_title":"Mine"}`, wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forEachStore(t, func(t *testing.T, s Store) {
+				useStore(t, s)
+				req := seedRequests(t, s, Request{})[0]
+
+				w := serve(RequestHandler, tt.caller, tt.method, "/requests/"+strconv.Itoa(req.ID), tt.body)
+				if w.Code != tt.wantStatus {
+					t.Fatalf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+				}
+
+				stored, err := s.Get(context.Background(), req.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if tt.wantStatus != http.StatusOK {
+					if stored.GigTitle != req.GigTitle || stored.Client != req.Client || stored.ClientEmail != req.ClientEmail || stored.SupplierEmail != req.SupplierEmail {
+						t.Errorf("rejected update changed the request to %+v", stored)
+					}
+					return
+				}
+				if stored.GigTitle != tt.wantTitle || stored.Client != tt.wantClient {
+					t.Errorf("stored %q by %q, want %q by %q", stored.GigTitle, stored.Client, tt.wantTitle, tt.wantClient)
+				}
+				if stored.Status != req.Status || !stored.CreatedAt.Equal(req.CreatedAt) {
+					t.Errorf("update changed status or created_at: %+v", stored)
+				}
+			})
+		})
+	}
+}
+
+func TestChangeRequestStatus(t *testing.T) {
+	admin := Caller{Role: RoleAdmin}
+
+	tests := []struct {
+		from       Status
+		to         Status
+		caller     Caller
+		wantStatus int
+	}{
+		{from: StatusPending, to: StatusAccepted, caller: admin, wantStatus: http.StatusOK},
+		{from: StatusPending, to: StatusDeclined, caller: admin, wantStatus: http.StatusOK},
+		{from: StatusAccepted, to: StatusCompleted, caller: admin, wantStatus: http.StatusOK},
+		{from: StatusPending, to: StatusCompleted, caller: admin, wantStatus: http.StatusConflict},
+		{from: StatusPending, to: StatusPending, caller: admin, wantStatus: http.StatusConflict},
+		{from: StatusAccepted, to: StatusDeclined, caller: admin, wantStatus: http.StatusConflict},
+		{from: StatusAccepted, to: StatusPending, caller: admin, wantStatus: http.StatusConflict},
+		{from: StatusDeclined, to: StatusAccepted, caller: admin, wantStatus: http.StatusConflict},
+		{from: StatusCompleted, to: StatusAccepted, caller: admin, wantStatus: http.StatusConflict},
+		{from: StatusPending, to: "archived", caller: admin, wantStatus: http.StatusBadRequest},
+		{from: StatusPending, to: StatusAccepted, caller: Caller{Role: RoleSupplier, Email: "s@b.co"}, wantStatus: http.StatusOK},
+		{from: StatusPending, to: StatusAccepted, caller: Caller{Role: RoleClient, Email: "c@b.co"}, wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.from)+" to "+string(tt.to)+" as "+tt.caller.Role, func(t *testing.T) {
+			forEachStore(t, func(t *testing.T, s Store) {
+				useStore(t, s)
+				req := seedRequests(t, s, Request{Status: tt.from})[0]
+
+				w := serve(RequestHandler, tt.caller, "POST", "/requests/"+strconv.Itoa(req.ID)+"/status", `{"status":"`+string(tt.to)+`"}`)
+				if w.Code != tt.wantStatus {
+					t.Fatalf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+				}
+				if tt.wantStatus == http.StatusConflict && !strings.Contains(w.Body.String(), codeInvalidTransition) {
+					t.Errorf("409 without code %s: %s", codeInvalidTransition, w.Body)
+				}
+
+				want := tt.from
+				if tt.wantStatus == http.StatusOK {
+					want = tt.to
+				}
+				if stored, err := s.Get(context.Background(), req.ID); err != nil || stored.Status != want {
+					t.Errorf("stored status %q (err %v), want %q", stored.Status, err, want)
+				}
+			})
+		})
+	}
+}
+
+func TestDeletedRequestsHidden(t *testing.T) {
+	admin := Caller{Role: RoleAdmin}
+	supplier := Caller{Role: RoleSupplier, Email: "s@b.co"}
+
+	tests := []struct {
+		name        string
+		caller      Caller
+		query       string
+		wantDeleted bool
+	}{
+		{name: "admin", caller: admin},
+		{name: "admin including deleted", caller: admin, query: "?include_deleted=true", wantDeleted: true},
+		{name: "supplier", caller: supplier},
+		{name: "supplier including deleted", caller: supplier, query: "?include_deleted=true"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forEachStore(t, func(t *testing.T, s Store) {
+				useStore(t, s)
+				reqs := seedRequests(t, s, Request{GigTitle: "Kept"}, Request{GigTitle: "Spam"})
+				kept, deleted := reqs[0], reqs[1]
+				if w := serve(RequestHandler, supplier, "DELETE", "/requests/"+strconv.Itoa(deleted.ID), ""); w.Code != http.StatusNoContent {
+					t.Fatalf("delete status %d: %s", w.Code, w.Body)
+				}
+
+				w := serve(RequestsHandler, tt.caller, "GET", "/requests"+tt.query, "")
+				if w.Code != http.StatusOK {
+					t.Fatalf("list status %d: %s", w.Code, w.Body)
+				}
+				var listed []Request
+				if err := json.Unmarshal(w.Body.Bytes(), &listed); err != nil {
+					t.Fatal(err)
+				}
+				wantIDs := []int{kept.ID}
+				if tt.wantDeleted {
+					wantIDs = append(wantIDs, deleted.ID)
+				}
+				if gotIDs := requestIDs(listed); !slices.Equal(gotIDs, wantIDs) {
+					t.Errorf("listed IDs %v, want %v", gotIDs, wantIDs)
+				}
+				if total := w.Header().Get("X-Total-Count"); total != strconv.Itoa(len(wantIDs)) {
+					t.Errorf("X-Total-Count %s, want %d", total, len(wantIDs))
+				}
+
+				wantGet := http.StatusNotFound
+				if tt.wantDeleted {
+					wantGet = http.StatusOK
+				}
+				if w := serve(RequestHandler, tt.caller, "GET", "/requests/"+strconv.Itoa(deleted.ID)+tt.query, ""); w.Code != wantGet {
+					t.Errorf("get deleted status %d, want %d", w.Code, wantGet)
+				}
+				if w := serve(RequestHandler, tt.caller, "GET", "/requests/"+strconv.Itoa(kept.ID)+tt.query, ""); w.Code != http.StatusOK {
+					t.Errorf("get kept status %d, want 200", w.Code)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// --- Markdown Rendering ---
+
+// details is stored as the client wrote it (markdown). Reads with ?render=html
+// also return details_html: the markdown rendered and then sanitized, so
+// frontends can insert it directly without their own renderer or sanitizer.
+
+var (
+	// markdownRenderer is CommonMark plus GitHub-style tables, strikethrough and autolinks.
+	// Raw HTML in the source is dropped by goldmark, and the sanitizer is the
+	// backstop for anything that slips through.
+	markdownRenderer = goldmark.New(goldmark.WithExtensions(
+		// Column alignment as an align attribute, since the sanitizer strips style
+		extension.NewTable(extension.WithTableCellAlignMethod(extension.TableCellAlignAttribute)),
+		extension.Strikethrough,
+		extension.Linkify,
+	))
+
+	// markdownPolicy is a strict allowlist: formatting, lists, quotes, code,
+	// tables and http(s)/mailto links, which are forced to rel="nofollow noreferrer".
+	markdownPolicy = newMarkdownPolicy()
+)
+
+func newMarkdownPolicy() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+	p.AllowElements("p", "br", "hr", "strong", "em", "del", "code", "pre", "blockquote",
+		"ul", "ol", "li", "h1", "h2", "h3", "h4", "h5", "h6",
+		"table", "thead", "tbody", "tr", "th", "td")
+	p.AllowAttrs("start").Matching(bluemonday.Integer).OnElements("ol")
+	p.AllowAttrs("align").Matching(bluemonday.CellAlign).OnElements("th", "td")
+	p.AllowAttrs("href").OnElements("a")
+	p.AllowURLSchemes("http", "https", "mailto")
+	p.RequireParseableURLs(true)
+	p.RequireNoFollowOnLinks(true)
+	p.AddTargetBlankToFullyQualifiedLinks(false)
+	p.RequireNoReferrerOnLinks(true)
+	return p
+}
+
+// renderMarkdown converts markdown to sanitized HTML.
+func renderMarkdown(src string) (string, error) {
+	var buf bytes.Buffer
+	if err := markdownRenderer.Convert([]byte(src), &buf); err != nil {
+		return "", err
+	}
+	return markdownPolicy.Sanitize(buf.String()), nil
+}
+
+// parseRenderParam reads ?render; "html" asks for details_html. On an unknown
+// value it writes a 400 and returns false.
+func parseRenderParam(w http.ResponseWriter, r *http.Request) (renderHTML bool, ok bool) {
+	switch r.URL.Query().Get("render") {
+	case "":
+		return false, true
+	case "html":
+		return true, true
+	default:
+		invalidParam(w, r, "render", "must be html")
+		return false, false
+	}
+}
+
+// renderDetails fills in req.DetailsHTML from req.Details.
+func renderDetails(req *Request) error {
+	html, err := renderMarkdown(req.Details)
+	if err != nil {
+		return err
+	}
+	req.DetailsHTML = html
+	return nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// --- Prometheus Metrics ---
+
+var (
+	httpRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests served, by route, method and status.",
+	}, []string{"route", "method", "status"})
+
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency, by route and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	storeOperationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "store_operation_duration_seconds",
+		Help:    "Store call latency, by operation and outcome.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"operation", "outcome"})
+)
+
+// registerMetrics registers the collectors, including a gauge of stored
+// requests that is counted from the store on each scrape.
+func registerMetrics(s Store) {
+	storedRequests := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "stored_requests",
+		Help:        "Requests in the store, excluding soft-deleted ones.",
+		ConstLabels: prometheus.Labels{"backend": storageBackend},
+	}, func() float64 {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		_, total, err := s.List(ctx, ListFilter{Limit: 1})
+		if err != nil {
+			slog.Error("Error counting requests for metrics", "err", err)
+			return 0
+		}
+		return float64(total)
+	})
+
+	prometheus.MustRegister(httpRequestsTotal, httpRequestDuration, storeOperationDuration, storedRequests)
+}
+
+// MetricsHandler serves the Prometheus exposition format on /metrics.
+var MetricsHandler = promhttp.Handler()
+
+// MetricsMiddleware records every request against the mux pattern it matched,
+// so /requests/42 and /requests/43 share the "/requests/" series. WebSocket
+// connections are counted but kept out of the duration histogram.
+func MetricsMiddleware(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		route := "unmatched"
+		if _, pattern := mux.Handler(r); pattern != "" {
+			route = pattern
+		}
+
+		httpRequestsTotal.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).Inc()
+		if !rec.hijacked {
+			httpRequestDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+		}
+	})
+}
+
+// instrumentedStore times every call to the wrapped Store.
+type instrumentedStore struct {
+	Store
+}
+
+// observe records one store call's duration. ErrNotFound counts as a normal outcome.
+func observe(operation string, start time.Time, err error) {
+	outcome := "ok"
+	switch {
+	case errors.Is(err, ErrNotFound):
+		outcome = "not_found"
+	case err != nil:
+		outcome = "error"
+	}
+	storeOperationDuration.WithLabelValues(operation, outcome).Observe(time.Since(start).Seconds())
+}
+
+func (s instrumentedStore) Create(ctx context.Context, req Request) (Request, error) {
+	start := time.Now()
+	req, err := s.Store.Create(ctx, req)
+	observe("create", start, err)
+	return req, err
+}
+
+func (s instrumentedStore) CreateMany(ctx context.Context, reqs []Request) ([]Request, error) {
+	start := time.Now()
+	reqs, err := s.Store.CreateMany(ctx, reqs)
+	observe("create_many", start, err)
+	return reqs, err
+}
+
+func (s instrumentedStore) List(ctx context.Context, filter ListFilter) ([]Request, int, error) {
+	start := time.Now()
+	reqs, total, err := s.Store.List(ctx, filter)
+	observe("list", start, err)
+	return reqs, total, err
+}
+
+func (s instrumentedStore) Get(ctx context.Context, id int) (Request, error) {
+	start := time.Now()
+	req, err := s.Store.Get(ctx, id)
+	observe("get", start, err)
+	return req, err
+}
+
+func (s instrumentedStore) Update(ctx context.Context, req Request) (Request, error) {
+	start := time.Now()
+	req, err := s.Store.Update(ctx, req)
+	observe("update", start, err)
+	return req, err
+}
+
+func (s instrumentedStore) Delete(ctx context.Context, id int) error {
+	start := time.Now()
+	err := s.Store.Delete(ctx, id)
+	observe("delete", start, err)
+	return err
+}
+
+// Close closes the wrapped store if it holds resources, so shutdown still finds it.
+func (s instrumentedStore) Close() error {
+	if closer, ok := s.Store.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// --- Mutual TLS for Internal Services ---
+
+// mtlsConfig is read from MTLS_* environment variables. The listener is only
+// started when MTLS_PORT is set.
+type mtlsConfig struct {
+	Port         string
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string
+	// Identities maps a client certificate's Common Name to a service identity.
+	Identities map[string]string
+}
+
+// loadMTLSConfig reads the mTLS settings. MTLS_IDENTITIES is a comma separated
+// list of cn=service pairs, e.g. "billing.internal=billing,ops-cron=cron".
+func loadMTLSConfig() (mtlsConfig, error) {
+	cfg := mtlsConfig{
+		Port:         os.Getenv("MTLS_PORT"),
+		CertFile:     os.Getenv("MTLS_CERT_FILE"),
+		KeyFile:      os.Getenv("MTLS_KEY_FILE"),
+		ClientCAFile: os.Getenv("MTLS_CLIENT_CA_FILE"),
+		Identities:   map[string]string{},
+	}
+
+	if cfg.Port == "" {
+		return cfg, nil
+	}
+	if cfg.CertFile == "" || cfg.KeyFile == "" || cfg.ClientCAFile == "" {
+		return cfg, fmt.Errorf("MTLS_PORT requires MTLS_CERT_FILE, MTLS_KEY_FILE and MTLS_CLIENT_CA_FILE")
+	}
+
+	for _, pair := range strings.Split(os.Getenv("MTLS_IDENTITIES"), ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		cn, service, ok := strings.Cut(pair, "=")
+		if !ok || cn == "" || service == "" {
+			return cfg, fmt.Errorf("invalid MTLS_IDENTITIES entry %q (want cn=service)", pair)
+		}
+		cfg.Identities[cn] = service
+	}
+
+	return cfg, nil
+}
+
+// serviceIdentityKey is the context key for the authenticated service identity.
+type serviceIdentityKey struct{}
+
+// serviceIdentityFromContext returns the internal service that made the
+// request over mTLS, if any.
+func serviceIdentityFromContext(ctx context.Context) (string, bool) {
+	service, ok := ctx.Value(serviceIdentityKey{}).(string)
+	return service, ok
+}
+
+// MTLSIdentityHandler maps the verified client certificate to a service
+// identity and rejects certificates whose CN isn't in the identity map.
+func MTLSIdentityHandler(identities map[string]string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+			writeError(w, r, http.StatusUnauthorized, "Client certificate required")
+			return
+		}
+
+		cn := r.TLS.PeerCertificates[0].Subject.CommonName
+		service, ok := identities[cn]
+		if !ok {
+			slog.WarnContext(r.Context(), "mTLS: rejected client certificate with unknown CN", "cn", cn)
+			writeError(w, r, http.StatusForbidden, "Forbidden")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), serviceIdentityKey{}, service)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// newMTLSServer builds the mutual-TLS server for internal callers; main runs and stops it.
+func newMTLSServer(cfg mtlsConfig, handler http.Handler) (*http.Server, error) {
+	caPEM, err := os.ReadFile(cfg.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading client CA: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates found in %s", cfg.ClientCAFile)
+	}
+
+	server := &http.Server{
+		Addr:    ":" + cfg.Port,
+		Handler: MTLSIdentityHandler(cfg.Identities, handler),
+		TLSConfig: &tls.Config{
+			ClientAuth: tls.RequireAndVerifyClientCert,
+			ClientCAs:  pool,
+			MinVersion: tls.VersionTLS12,
+		},
+	}
+
+	return server, nil
+}
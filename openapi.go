@@ -0,0 +1,492 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- OpenAPI Document ---
+
+// The OpenAPI 3 document at /openapi.json is generated from apiOperations and
+// the Go types the handlers actually encode and decode, so schemas follow the
+// structs. Every new route needs an entry in apiOperations. With DOCS_UI=true,
+// /docs also serves Swagger UI for it.
+//
+// Swagger UI is loaded from unpkg at a pinned version, and browsers only run it
+// if it matches the Subresource Integrity hashes in DOCS_UI_CSS_INTEGRITY and
+// DOCS_UI_JS_INTEGRITY, so a compromised CDN can't run script on our origin.
+// The server won't start with DOCS_UI=true until both are set. For each of
+// swagger-ui.css and swagger-ui-bundle.js at swaggerUIVersion:
+//
+//	echo "sha384-$(curl -s https://unpkg.com/swagger-ui-dist@5.17.14/swagger-ui-bundle.js | openssl dgst -sha384 -binary | openssl base64 -A)"
+
+var docsUIEnabled = os.Getenv("DOCS_UI") == "true"
+
+// swaggerUIVersion is the exact swagger-ui-dist release /docs loads. Bumping it
+// means recomputing both integrity hashes.
+const swaggerUIVersion = "5.17.14"
+
+// apiParam is a query or path parameter.
+type apiParam struct {
+	Name        string
+	In          string // "query" or "path"
+	Type        string // JSON schema type; "string" if empty
+	Format      string
+	Enum        []string
+	Required    bool
+	Description string
+}
+
+// apiOperation describes one method on one route.
+type apiOperation struct {
+	Method      string
+	Path        string
+	OperationID string
+	Tag         string
+	Summary     string
+	Params      []apiParam
+	Body        any  // Zero value of the JSON body's type, or nil for none
+	CSVBody     bool // The body may also be text/csv
+	Status      int  // Success status
+	Response    any  // Zero value of the success body's type, or nil for none
+	ContentType string
+	Public      bool // Never needs credentials
+	Paged       bool // Reports the total number of matches in X-Total-Count
+	Errors      []int
+}
+
+// Parameters shared by several operations.
+var (
+	idParam = apiParam{Name: "id", In: "path", Type: "integer", Required: true}
+
+	includeDeletedParam = apiParam{Name: "include_deleted", In: "query", Type: "boolean", Description: "Include soft-deleted requests; admins only, ignored for anyone else"}
+
+	renderParam = apiParam{Name: "render", In: "query", Enum: []string{"html"}, Description: "Also return details rendered from Markdown as sanitized HTML in details_html"}
+
+	listFilterParams = []apiParam{
+		{Name: "supplier_email", In: "query", Format: "email"},
+		{Name: "client_email", In: "query", Format: "email"},
+		{Name: "status", In: "query", Enum: statusNames()},
+		{Name: "created_after", In: "query", Format: "date-time"},
+		{Name: "created_before", In: "query", Format: "date-time"},
+		{Name: "q", In: "query", Description: "Words that must all appear in the gig title, client or details"},
+		includeDeletedParam,
+		{Name: "limit", In: "query", Type: "integer"},
+		{Name: "offset", In: "query", Type: "integer"},
+		{Name: "sort", In: "query", Enum: SortFields},
+		{Name: "order", In: "query", Enum: []string{"asc", "desc"}},
+	}
+
+	supplierEmailParam = apiParam{Name: "supplier_email", In: "query", Format: "email", Description: "Admins only; suppliers always see their own"}
+)
+
+// apiOperations lists every route the server exposes.
+var apiOperations = []apiOperation{
+	{Method: "GET", Path: "/requests", OperationID: "listRequests", Tag: "requests", Summary: "List gig requests",
+		Params: append(append([]apiParam{}, listFilterParams...), renderParam), Status: 200, Response: []Request{}, Paged: true,
+		Errors: []int{400, 401, 403}},
+	{Method: "POST", Path: "/requests", OperationID: "createRequest", Tag: "requests", Summary: "Submit a gig request",
+		Body: Request{}, Status: 201, Response: Request{}, Errors: []int{400, 401, 403, 429}},
+	{Method: "GET", Path: "/requests/export", OperationID: "exportRequests", Tag: "requests", Summary: "Export requests as CSV",
+		Params: append(append([]apiParam{}, listFilterParams...), apiParam{Name: "format", In: "query", Enum: []string{"csv"}}), Status: 200,
+		Response: "", ContentType: "text/csv", Errors: []int{400, 401, 403}},
+	{Method: "POST", Path: "/requests/import", OperationID: "importRequests", Tag: "requests", Summary: "Import requests in one transaction",
+		Body: []Request{}, CSVBody: true, Status: 201, Response: importReport{}, Errors: []int{400, 401, 403, 429}},
+	{Method: "GET", Path: "/requests/{id}", OperationID: "getRequest", Tag: "requests", Summary: "Get a gig request",
+		Params: []apiParam{idParam, includeDeletedParam, renderParam}, Status: 200, Response: Request{}, Errors: []int{400, 401, 404}},
+	{Method: "PUT", Path: "/requests/{id}", OperationID: "replaceRequest", Tag: "requests", Summary: "Replace a gig request's editable fields",
+		Params: []apiParam{idParam}, Body: Request{}, Status: 200, Response: Request{}, Errors: []int{400, 401, 403, 404}},
+	{Method: "PATCH", Path: "/requests/{id}", OperationID: "patchRequest", Tag: "requests", Summary: "Update some of a gig request's fields",
+		Params: []apiParam{idParam}, Body: requestPatch{}, Status: 200, Response: Request{}, Errors: []int{400, 401, 403, 404}},
+	{Method: "DELETE", Path: "/requests/{id}", OperationID: "deleteRequest", Tag: "requests", Summary: "Soft-delete a gig request",
+		Params: []apiParam{idParam}, Status: 204, Errors: []int{401, 404}},
+	{Method: "POST", Path: "/requests/{id}/status", OperationID: "changeRequestStatus", Tag: "requests", Summary: "Move a gig request to a new status",
+		Params: []apiParam{idParam}, Body: statusChange{}, Status: 200, Response: Request{}, Errors: []int{400, 401, 403, 404, 409}},
+
+	{Method: "GET", Path: "/webhooks", OperationID: "listWebhooks", Tag: "webhooks", Summary: "List webhooks",
+		Params: []apiParam{supplierEmailParam}, Status: 200, Response: []Webhook{}, Errors: []int{401, 403}},
+	{Method: "POST", Path: "/webhooks", OperationID: "createWebhook", Tag: "webhooks", Summary: "Register a webhook",
+		Body: webhookInput{}, Status: 201, Response: webhookCreated{}, Errors: []int{400, 401, 403}},
+	{Method: "GET", Path: "/webhooks/{id}", OperationID: "getWebhook", Tag: "webhooks", Summary: "Get a webhook",
+		Params: []apiParam{idParam}, Status: 200, Response: Webhook{}, Errors: []int{401, 404}},
+	{Method: "PUT", Path: "/webhooks/{id}", OperationID: "replaceWebhook", Tag: "webhooks", Summary: "Change a webhook's URL and events",
+		Params: []apiParam{idParam}, Body: webhookInput{}, Status: 200, Response: Webhook{}, Errors: []int{400, 401, 404}},
+	{Method: "DELETE", Path: "/webhooks/{id}", OperationID: "deleteWebhook", Tag: "webhooks", Summary: "Delete a webhook",
+		Params: []apiParam{idParam}, Status: 204, Errors: []int{401, 404}},
+
+	{Method: "GET", Path: "/ws", OperationID: "connectWebSocket", Tag: "events", Summary: "Open a WebSocket for request events, presence and typing",
+		Params: []apiParam{
+			{Name: "supplier_email", In: "query", Format: "email", Description: "Feed to subscribe to; defaults to a supplier's own"},
+			{Name: "access_token", In: "query", Description: "Credentials, for browsers that can't set headers"},
+			{Name: "resume_token", In: "query", Description: "Session to resume after a dropped connection"},
+			{Name: "last_seq", In: "query", Type: "integer", Description: "Last event seq received, when resuming"},
+		},
+		Status: 101, Response: wsMessage{}, Errors: []int{400, 401, 403}},
+
+	{Method: "GET", Path: "/api-keys", OperationID: "listAPIKeys", Tag: "admin", Summary: "List API keys",
+		Params: []apiParam{{Name: "supplier_email", In: "query", Format: "email"}}, Status: 200, Response: []APIKey{}, Errors: []int{401, 403}},
+	{Method: "POST", Path: "/api-keys", OperationID: "createAPIKey", Tag: "admin", Summary: "Issue an API key",
+		Body: apiKeyInput{}, Status: 201, Response: apiKeyCreated{}, Errors: []int{400, 401, 403}},
+	{Method: "DELETE", Path: "/api-keys/{id}", OperationID: "revokeAPIKey", Tag: "admin", Summary: "Revoke an API key",
+		Params: []apiParam{idParam}, Status: 204, Errors: []int{401, 403, 404}},
+	{Method: "GET", Path: "/admin/analytics/dataset", OperationID: "getAnalyticsDataset", Tag: "admin", Summary: "Anonymized dataset of all requests",
+		Status: 200, Response: []AnonymizedRequest{}, Errors: []int{401, 403, 503}},
+	{Method: "GET", Path: "/admin/analytics/heatmap", OperationID: "getAnalyticsHeatmap", Tag: "admin", Summary: "Requests by weekday and hour",
+		Params: []apiParam{
+			{Name: "from", In: "query", Format: "date-time"},
+			{Name: "to", In: "query", Format: "date-time"},
+			{Name: "tz", In: "query", Description: "IANA time zone, e.g. Europe/Paris"},
+		},
+		Status: 200, Response: Heatmap{}, Errors: []int{400, 401, 403}},
+	{Method: "GET", Path: "/metrics", OperationID: "getMetrics", Tag: "admin", Summary: "Prometheus metrics",
+		Status: 200, Response: "", ContentType: "text/plain", Errors: []int{401, 403}},
+
+	{Method: "GET", Path: "/version", OperationID: "getVersion", Tag: "meta", Summary: "Build information and enabled features",
+		Status: 200, Response: BuildInfo{}, Public: true},
+	{Method: "GET", Path: "/openapi.json", OperationID: "getOpenAPI", Tag: "meta", Summary: "This document",
+		Status: 200, Response: map[string]any{}, Public: true},
+}
+
+// statusNames lists the known statuses for the status enum.
+func statusNames() []string {
+	return []string{string(StatusPending), string(StatusAccepted), string(StatusDeclined), string(StatusCompleted)}
+}
+
+// readOnlyFields are set by the server and ignored in request bodies, by schema and JSON name.
+var readOnlyFields = map[string]bool{
+	"Request.id":           true,
+	"Request.status":       true,
+	"Request.created_at":   true,
+	"Request.deleted_at":   true,
+	"Request.details_html": true,
+	"Consent.accepted_at":  true,
+	"Consent.ip":           true,
+}
+
+// requiredBodyFields are the fields a request body must include, by schema and
+// JSON name, matching what the handlers reject when missing. Anything else, and
+// every field of a patch, may be left out.
+var requiredBodyFields = map[string]bool{
+	"Request.gig_title":          true,
+	"Request.client":             true,
+	"Request.client_email":       true,
+	"Request.supplier_email":     true,
+	"Consent.terms_version":      true,
+	"statusChange.status":        true,
+	"webhookInput.url":           true,
+	"apiKeyInput.supplier_email": true,
+}
+
+// schemaRegistry turns Go types into JSON schemas, collecting named structs as
+// components. Request bodies get their own components, from a registry with
+// body set, since what a client must send differs from what it gets back.
+type schemaRegistry struct {
+	schemas map[string]any
+	body    bool
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// componentName exports a Go type name for the document, e.g. wsMessage -> WSMessage.
+func componentName(t reflect.Type) string {
+	name := t.Name()
+	for _, initialism := range []string{"api", "ws"} {
+		if strings.HasPrefix(name, initialism) {
+			return strings.ToUpper(initialism) + name[len(initialism):]
+		}
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+func (g *schemaRegistry) schema(t reflect.Type) map[string]any {
+	switch t {
+	case timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case reflect.TypeOf(Status("")):
+		return map[string]any{"type": "string", "enum": statusNames()}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schema(t.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Array:
+		return map[string]any{"type": "array", "items": g.schema(t.Elem()), "minItems": t.Len(), "maxItems": t.Len()}
+	case reflect.Map:
+		if t.Elem().Kind() == reflect.Interface {
+			return map[string]any{"type": "object"}
+		}
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		name := componentName(t)
+		if g.body && !strings.HasSuffix(name, "Input") {
+			name += "Input"
+		}
+		if _, ok := g.schemas[name]; !ok {
+			g.schemas[name] = nil // Reserve the name in case the type refers to itself
+			g.schemas[name] = g.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	default:
+		return map[string]any{}
+	}
+}
+
+// object describes a struct by its JSON tags. Fields without omitempty are
+// always present in responses, so they are listed as required; in request
+// bodies only requiredBodyFields are.
+func (g *schemaRegistry) object(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	required := []string{}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if !f.IsExported() || tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+
+		s := g.schema(f.Type)
+		if readOnlyFields[t.Name()+"."+name] {
+			s["readOnly"] = true
+		}
+		properties[name] = s
+		if g.body {
+			if requiredBodyFields[t.Name()+"."+name] {
+				required = append(required, name)
+			}
+		} else if !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+
+	s := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+// operation renders one apiOperation.
+func (g *schemaRegistry) operation(op apiOperation) map[string]any {
+	out := map[string]any{
+		"operationId": op.OperationID,
+		"summary":     op.Summary,
+		"tags":        []string{op.Tag},
+	}
+
+	if len(op.Params) > 0 {
+		params := []any{}
+		for _, p := range op.Params {
+			s := map[string]any{"type": "string"}
+			if p.Type != "" {
+				s["type"] = p.Type
+			}
+			if p.Format != "" {
+				s["format"] = p.Format
+			}
+			if len(p.Enum) > 0 {
+				s["enum"] = p.Enum
+			}
+			param := map[string]any{"name": p.Name, "in": p.In, "schema": s}
+			if p.Required {
+				param["required"] = true
+			}
+			if p.Description != "" {
+				param["description"] = p.Description
+			}
+			params = append(params, param)
+		}
+		out["parameters"] = params
+	}
+
+	if op.Body != nil {
+		body := &schemaRegistry{schemas: g.schemas, body: true}
+		content := map[string]any{"application/json": map[string]any{"schema": body.schema(reflect.TypeOf(op.Body))}}
+		if op.CSVBody {
+			content["text/csv"] = map[string]any{"schema": map[string]any{"type": "string"}}
+		}
+		out["requestBody"] = map[string]any{"required": true, "content": content}
+	}
+
+	success := map[string]any{"description": http.StatusText(op.Status)}
+	if op.Response != nil {
+		contentType := op.ContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		success["content"] = map[string]any{contentType: map[string]any{"schema": g.schema(reflect.TypeOf(op.Response))}}
+	}
+	if op.Paged {
+		success["headers"] = map[string]any{
+			"X-Total-Count": map[string]any{"description": "Matching requests before paging", "schema": map[string]any{"type": "integer"}},
+		}
+	}
+	responses := map[string]any{strconv.Itoa(op.Status): success}
+
+	errorSchema := g.schema(reflect.TypeOf(errorEnvelope{}))
+	for _, status := range append(op.Errors, http.StatusInternalServerError) {
+		responses[strconv.Itoa(status)] = map[string]any{
+			"description": http.StatusText(status),
+			"content":     map[string]any{"application/json": map[string]any{"schema": errorSchema}},
+		}
+	}
+	out["responses"] = responses
+
+	if op.Public {
+		out["security"] = []any{}
+	}
+	return out
+}
+
+// buildOpenAPI assembles the whole document.
+func buildOpenAPI() map[string]any {
+	g := &schemaRegistry{schemas: map[string]any{}}
+
+	ops := apiOperations
+	if docsUIEnabled {
+		ops = append(ops[:len(ops):len(ops)], apiOperation{Method: "GET", Path: "/docs", OperationID: "getDocs", Tag: "meta",
+			Summary: "Swagger UI for this document", Status: 200, Response: "", ContentType: "text/html", Public: true})
+	}
+
+	paths := map[string]any{}
+	for _, op := range ops {
+		item, ok := paths[op.Path].(map[string]any)
+		if !ok {
+			item = map[string]any{}
+			paths[op.Path] = item
+		}
+		item[strings.ToLower(op.Method)] = g.operation(op)
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "Gig Requests API",
+			"version": version,
+			"description": "Errors always come as {\"error\": {...}}. Without REQUIRE_API_KEYS the API is open; " +
+				"partner systems may also authenticate with HTTP message signatures or mTLS.",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": g.schemas,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "An API key (gk_...) or, when configured, a JWT",
+				},
+			},
+		},
+		"security": []any{map[string]any{"bearerAuth": []string{}}, map[string]any{}},
+	}
+}
+
+var (
+	openAPIOnce sync.Once
+	openAPIJSON []byte
+)
+
+// OpenAPIHandler handles GET /openapi.json. The document is built on first use.
+func OpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	openAPIOnce.Do(func() {
+		var err error
+		if openAPIJSON, err = json.MarshalIndent(buildOpenAPI(), "", "  "); err != nil {
+			slog.Error("Error encoding OpenAPI document", "err", err)
+		}
+	})
+	if openAPIJSON == nil {
+		writeError(w, r, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(openAPIJSON)
+}
+
+// docsPageTemplate loads Swagger UI from a CDN and points it at /openapi.json.
+// It is filled in with the version and integrity hashes by loadDocsPage.
+const docsPageTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Gig Requests API</title>
+<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@%[1]s/swagger-ui.css" integrity="%[2]s" crossorigin="anonymous">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@%[1]s/swagger-ui-bundle.js" integrity="%[3]s" crossorigin="anonymous"></script>
+<script>SwaggerUIBundle({url: "/openapi.json", dom_id: "#swagger-ui"});</script>
+</body>
+</html>
+`
+
+// docsPage is the /docs page, built by loadDocsPage in main.
+var docsPage string
+
+// loadDocsPage builds docsPage from the integrity hashes in the environment.
+func loadDocsPage() error {
+	for _, name := range []string{"DOCS_UI_CSS_INTEGRITY", "DOCS_UI_JS_INTEGRITY"} {
+		if !validIntegrity(os.Getenv(name)) {
+			return fmt.Errorf("%s must be a sha256-, sha384- or sha512- integrity hash of swagger-ui-dist %s", name, swaggerUIVersion)
+		}
+	}
+	css, js := os.Getenv("DOCS_UI_CSS_INTEGRITY"), os.Getenv("DOCS_UI_JS_INTEGRITY")
+
+	docsPage = fmt.Sprintf(docsPageTemplate, swaggerUIVersion, css, js)
+	return nil
+}
+
+// validIntegrity reports whether v looks like one Subresource Integrity hash.
+func validIntegrity(v string) bool {
+	for _, prefix := range []string{"sha256-", "sha384-", "sha512-"} {
+		if digest, ok := strings.CutPrefix(v, prefix); ok {
+			_, err := base64.StdEncoding.DecodeString(digest)
+			return digest != "" && err == nil
+		}
+	}
+	return false
+}
+
+// DocsHandler handles GET /docs, registered only with DOCS_UI=true.
+func DocsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(docsPage))
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// --- Outbound HTTP Policy ---
+
+// Every outbound call goes through newOutboundClient, or dial for SMTP, so
+// proxying and SSRF protection apply uniformly. There are two policies:
+// outbound for destinations the operator configured (ANOMALY_WEBHOOK_URL,
+// JWT_JWKS_URL, SendGrid and the SMTP relay), and webhookOutbound for the URLs
+// suppliers register as webhooks.
+//
+//	HTTPS_PROXY / HTTP_PROXY / NO_PROXY  standard proxy settings
+//	OUTBOUND_ALLOWED_HOSTS               if set, only these hosts may be called
+//	OUTBOUND_DENIED_HOSTS                these hosts may never be called
+//	OUTBOUND_ALLOW_PRIVATE=true          allow loopback/private/link-local targets,
+//	                                     for operator destinations only
+//
+// Host lists are comma separated; an entry like "*.example.com" matches
+// subdomains. They apply to both policies, but internal addresses are never
+// allowed for webhooks, and no call may target a configured proxy itself.
+
+// ErrDestinationBlocked is returned for calls to a host or address the policy forbids.
+var ErrDestinationBlocked = errors.New("outbound destination blocked by policy")
+
+// cgnatRange is carrier-grade NAT space, not covered by net.IP.IsPrivate.
+var cgnatRange = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// outboundPolicy decides which destinations outbound calls may reach.
+type outboundPolicy struct {
+	allowed      []string
+	denied       []string
+	allowPrivate bool
+	proxyHosts   map[string]bool // host:port of configured proxies, which are dialable only as proxies
+
+	lookup func(ctx context.Context, host string) ([]net.IPAddr, error) // net.DefaultResolver when nil
+}
+
+// loadOutboundPolicy reads the policy from the environment.
+func loadOutboundPolicy() *outboundPolicy {
+	p := &outboundPolicy{
+		allowed:      splitHostList(os.Getenv("OUTBOUND_ALLOWED_HOSTS")),
+		denied:       splitHostList(os.Getenv("OUTBOUND_DENIED_HOSTS")),
+		allowPrivate: os.Getenv("OUTBOUND_ALLOW_PRIVATE") == "true",
+		proxyHosts:   map[string]bool{},
+	}
+
+	// The operator chose the proxies, so they are exempt from the private-IP check
+	for _, name := range []string{"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy"} {
+		if u, err := url.Parse(os.Getenv(name)); err == nil && u.Host != "" {
+			p.proxyHosts[hostPort(u)] = true
+		}
+	}
+
+	return p
+}
+
+// forUserURLs returns a copy of p for URLs users supply, which may never reach
+// internal addresses whatever OUTBOUND_ALLOW_PRIVATE says.
+func (p *outboundPolicy) forUserURLs() *outboundPolicy {
+	q := *p
+	q.allowPrivate = false
+	return &q
+}
+
+// hostPort is the host:port to dial for u, with the scheme's default port.
+func hostPort(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(strings.ToLower(u.Hostname()), port)
+}
+
+// splitHostList parses a comma separated host list into lowercase entries.
+func splitHostList(v string) []string {
+	var hosts []string
+	for _, h := range strings.Split(v, ",") {
+		if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+			hosts = append(hosts, h)
+		}
+	}
+	return hosts
+}
+
+// hostMatches reports whether host matches any entry in list.
+func hostMatches(host string, list []string) bool {
+	for _, entry := range list {
+		if suffix, ok := strings.CutPrefix(entry, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if host == entry {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDestination rejects a destination host:port that is one of the
+// configured proxies. Connections to proxies skip the address check, so a URL
+// pointing at one directly would otherwise reach it, and whatever it fronts,
+// unchecked.
+func (p *outboundPolicy) checkDestination(addr string) error {
+	if p.proxyHosts[addr] {
+		return fmt.Errorf("%w: %s is the outbound proxy", ErrDestinationBlocked, addr)
+	}
+	return nil
+}
+
+// checkHost applies the allow and deny lists to a destination hostname.
+func (p *outboundPolicy) checkHost(host string) error {
+	host = strings.ToLower(host)
+	if hostMatches(host, p.denied) {
+		return fmt.Errorf("%w: %s is denied", ErrDestinationBlocked, host)
+	}
+	if len(p.allowed) > 0 && !hostMatches(host, p.allowed) {
+		return fmt.Errorf("%w: %s is not in the allowlist", ErrDestinationBlocked, host)
+	}
+	return nil
+}
+
+// checkIP rejects loopback, private, link-local and other internal addresses.
+func (p *outboundPolicy) checkIP(ip net.IP) error {
+	if p.allowPrivate {
+		return nil
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsMulticast() || cgnatRange.Contains(ip) {
+		return fmt.Errorf("%w: %s is an internal address", ErrDestinationBlocked, ip)
+	}
+	return nil
+}
+
+// resolve looks up host and checks every address it resolves to.
+func (p *outboundPolicy) resolve(ctx context.Context, host string) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, p.checkIP(ip)
+	}
+
+	lookup := p.lookup
+	if lookup == nil {
+		lookup = net.DefaultResolver.LookupIPAddr
+	}
+	addrs, err := lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	ips := make([]net.IP, 0, len(addrs))
+	for _, a := range addrs {
+		if err := p.checkIP(a.IP); err != nil {
+			return nil, err
+		}
+		ips = append(ips, a.IP)
+	}
+	return ips, nil
+}
+
+// dialContext resolves and checks the destination itself, then dials the
+// checked address, so DNS can't be rebound to an internal IP between the two.
+func (p *outboundPolicy) dialContext(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if p.proxyHosts[addr] {
+			return dialer.DialContext(ctx, network, addr)
+		}
+
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		ips, err := p.resolve(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		var lastErr error
+		for _, ip := range ips {
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		return nil, lastErr
+	}
+}
+
+// policyTransport enforces host lists on every request. When the request goes
+// through a proxy the proxy does the final DNS lookup, so the private-IP check
+// here is best effort; direct connections are also checked at dial time.
+type policyTransport struct {
+	policy *outboundPolicy
+	next   *http.Transport
+}
+
+func (t *policyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Hostname()
+	if err := t.policy.checkHost(host); err != nil {
+		return nil, err
+	}
+	if err := t.policy.checkDestination(hostPort(req.URL)); err != nil {
+		return nil, err
+	}
+
+	if proxy, err := t.next.Proxy(req); err == nil && proxy != nil {
+		if _, err := t.policy.resolve(req.Context(), host); err != nil {
+			return nil, err
+		}
+	}
+
+	return t.next.RoundTrip(req)
+}
+
+// outbound is the policy for operator-configured destinations, loaded once at startup.
+var outbound = loadOutboundPolicy()
+
+// webhookOutbound is the policy for user-supplied webhook URLs.
+var webhookOutbound = outbound.forUserURLs()
+
+// outboundDialer makes the TCP connections for every outbound call.
+var outboundDialer = &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}
+
+// newOutboundClient returns an HTTP client that honours the proxy settings and
+// the given policy. Redirects are re-checked as new requests.
+func newOutboundClient(policy *outboundPolicy, timeout time.Duration) *http.Client {
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           policy.dialContext(outboundDialer),
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &policyTransport{policy: policy, next: transport},
+	}
+}
+
+// dial opens a TCP connection to addr for protocols other than HTTP, such as
+// SMTP, under the same policy as newOutboundClient: the host lists and address
+// checks apply, and when HTTPS_PROXY covers the host the connection is
+// tunnelled through the proxy with CONNECT.
+func (p *outboundPolicy) dial(ctx context.Context, addr string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.checkHost(host); err != nil {
+		return nil, err
+	}
+	if err := p.checkDestination(strings.ToLower(addr)); err != nil {
+		return nil, err
+	}
+
+	proxy, err := http.ProxyFromEnvironment(&http.Request{URL: &url.URL{Scheme: "https", Host: addr}})
+	if err != nil {
+		return nil, err
+	}
+	if proxy == nil {
+		return p.dialContext(outboundDialer)(ctx, "tcp", addr)
+	}
+
+	// As in policyTransport, the proxy does the final lookup, so this is best effort
+	if _, err := p.resolve(ctx, host); err != nil {
+		return nil, err
+	}
+	return p.dialConnect(ctx, proxy, addr)
+}
+
+// dialConnect opens a CONNECT tunnel to addr through proxy.
+func (p *outboundPolicy) dialConnect(ctx context.Context, proxy *url.URL, addr string) (net.Conn, error) {
+	conn, err := p.dialContext(outboundDialer)(ctx, "tcp", hostPort(proxy))
+	if err != nil {
+		return nil, err
+	}
+	if proxy.Scheme == "https" {
+		conn = tls.Client(conn, &tls.Config{ServerName: proxy.Hostname()})
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	connect := &http.Request{
+		Method: "CONNECT",
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+	if proxy.User != nil {
+		password, _ := proxy.User.Password()
+		connect.SetBasicAuth(proxy.User.Username(), password)
+		connect.Header["Proxy-Authorization"] = connect.Header["Authorization"]
+		delete(connect.Header, "Authorization")
+	}
+	if err := connect.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, connect)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// The body of a successful CONNECT is the tunnel itself, so it isn't closed here
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy refused CONNECT to %s: %s", addr, resp.Status)
+	}
+	conn.SetDeadline(time.Time{})
+
+	return &bufferedConn{Conn: conn, r: br}, nil
+}
+
+// bufferedConn is a connection whose first bytes may already sit in r, read
+// ahead while parsing the proxy's response.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckIP(t *testing.T) {
+	tests := []struct {
+		ip      string
+		blocked bool
+	}{
+		{"127.0.0.1", true},
+		{"127.1.2.3", true},
+		{"::1", true},
+		{"10.0.0.5", true},
+		{"172.16.0.1", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true}, // Cloud metadata
+		{"fe80::1", true},
+		{"fd00::1", true},
+		{"100.64.0.1", true}, // Carrier-grade NAT
+		{"0.0.0.0", true},
+		{"::", true},
+		{"224.0.0.1", true},
+		{"::ffff:127.0.0.1", true},
+		{"::ffff:10.0.0.1", true},
+		{"93.184.216.34", false},
+		{"2606:4700::1111", false},
+		{"100.128.0.1", false}, // Just past the CGNAT range
+	}
+
+	p := &outboundPolicy{}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			err := p.checkIP(net.ParseIP(tt.ip))
+			if blocked := errors.Is(err, ErrDestinationBlocked); blocked != tt.blocked {
+				t.Fatalf("blocked = %v (err %v), want %v", blocked, err, tt.blocked)
+			}
+		})
+	}
+
+	allowing := &outboundPolicy{allowPrivate: true}
+	if err := allowing.checkIP(net.ParseIP("10.0.0.5")); err != nil {
+		t.Errorf("OUTBOUND_ALLOW_PRIVATE policy blocked a private address: %v", err)
+	}
+	if err := allowing.forUserURLs().checkIP(net.ParseIP("10.0.0.5")); !errors.Is(err, ErrDestinationBlocked) {
+		t.Errorf("user URL policy allowed a private address: %v", err)
+	}
+}
+
+func TestResolveChecksEveryAnswer(t *testing.T) {
+	answers := map[string][]string{
+		"public.example":   {"93.184.216.34"},
+		"loopback.example": {"127.0.0.1"},
+		"mixed.example":    {"93.184.216.34", "10.0.0.1"},
+		"metadata.example": {"169.254.169.254"},
+		"v6local.example":  {"2606:4700::1111", "fe80::1"},
+	}
+	p := &outboundPolicy{lookup: func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		ips, ok := answers[host]
+		if !ok {
+			return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		}
+		addrs := make([]net.IPAddr, len(ips))
+		for i, ip := range ips {
+			addrs[i] = net.IPAddr{IP: net.ParseIP(ip)}
+		}
+		return addrs, nil
+	}}
+
+	tests := []struct {
+		host    string
+		blocked bool
+	}{
+		{"public.example", false},
+		{"loopback.example", true},
+		{"mixed.example", true},
+		{"metadata.example", true},
+		{"v6local.example", true},
+		{"127.0.0.1", true}, // Literal addresses skip DNS but not the check
+		{"93.184.216.34", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			_, err := p.resolve(context.Background(), tt.host)
+			if blocked := errors.Is(err, ErrDestinationBlocked); blocked != tt.blocked {
+				t.Fatalf("blocked = %v (err %v), want %v", blocked, err, tt.blocked)
+			}
+		})
+	}
+
+	// Dialling must refuse the same names, not just resolve
+	dial := p.dialContext(&net.Dialer{Timeout: time.Second})
+	if _, err := dial(context.Background(), "tcp", "mixed.example:80"); !errors.Is(err, ErrDestinationBlocked) {
+		t.Errorf("dial to a name with an internal answer: err = %v, want blocked", err)
+	}
+}
+
+func TestOutboundClientBlocksInternalDestinations(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	for _, tt := range []struct {
+		name   string
+		policy *outboundPolicy
+		target string
+		wantOK bool
+	}{
+		{name: "loopback address", policy: &outboundPolicy{}, target: srv.URL},
+		{name: "loopback by name", policy: &outboundPolicy{}, target: "http://localhost:" + u.Port()},
+		{name: "allowed when private is allowed", policy: &outboundPolicy{allowPrivate: true}, target: srv.URL, wantOK: true},
+		{name: "webhook policy ignores allow private", policy: (&outboundPolicy{allowPrivate: true}).forUserURLs(), target: srv.URL},
+		{name: "denied host", policy: &outboundPolicy{allowPrivate: true, denied: []string{"127.0.0.1"}}, target: srv.URL},
+		{name: "not in allowlist", policy: &outboundPolicy{allowPrivate: true, allowed: []string{"*.example.com"}}, target: srv.URL},
+		{name: "destination is the proxy", policy: &outboundPolicy{proxyHosts: map[string]bool{u.Host: true}}, target: srv.URL},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := newOutboundClient(tt.policy, 5*time.Second).Get(tt.target)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if tt.wantOK {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrDestinationBlocked) {
+				t.Fatalf("err = %v, want blocked", err)
+			}
+		})
+	}
+}
+
+func TestOutboundClientRechecksRedirects(t *testing.T) {
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer internal.Close()
+
+	// Only the redirecting server is allowed, by name; the target is by address
+	redirector := httptest.NewServer(http.RedirectHandler(internal.URL, http.StatusFound))
+	defer redirector.Close()
+	ru, _ := url.Parse(redirector.URL)
+
+	p := &outboundPolicy{allowPrivate: true, allowed: []string{"localhost"}}
+	resp, err := newOutboundClient(p, 5*time.Second).Get("http://localhost:" + ru.Port())
+	if err == nil {
+		resp.Body.Close()
+	}
+	if !errors.Is(err, ErrDestinationBlocked) || !strings.Contains(err.Error(), "allowlist") {
+		t.Fatalf("err = %v, want the redirect blocked by the allowlist", err)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// --- Rate Limiting ---
+
+// POST /requests and /requests/import are rate limited with token buckets, one
+// per client IP and one per authenticated caller; a request must have a token
+// in both. The IP is the connection's unless it came through TRUSTED_PROXIES
+// (see clientIP), so a forged X-Forwarded-For can't pick a fresh bucket.
+//
+//	RATE_LIMIT_RPS     tokens added per second (default 2; 0 disables limiting)
+//	RATE_LIMIT_BURST   bucket size, i.e. requests allowed in a burst (default 10)
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter holds a token bucket per key.
+type rateLimiter struct {
+	mu        sync.Mutex
+	rate      float64 // Tokens per second
+	burst     float64
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// rateLimit is the shared limiter for POST /requests and imports, loaded in main. Nil disables limiting.
+var rateLimit *rateLimiter
+
+// loadRateLimiter reads the limits from the environment. It returns nil when limiting is off.
+func loadRateLimiter() *rateLimiter {
+	rps := 2.0
+	if v := os.Getenv("RATE_LIMIT_RPS"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 {
+			slog.Warn("Ignoring invalid RATE_LIMIT_RPS", "value", v)
+		} else {
+			rps = f
+		}
+	}
+	if rps == 0 {
+		return nil
+	}
+
+	return &rateLimiter{
+		rate:    rps,
+		burst:   float64(envInt("RATE_LIMIT_BURST", 10)),
+		buckets: map[string]*tokenBucket{},
+	}
+}
+
+// rateDecision is the outcome of taking a token from a bucket.
+type rateDecision struct {
+	allowed    bool
+	remaining  int
+	retryAfter time.Duration // Until the next token, when not allowed
+	resetAfter time.Duration // Until the bucket is full again
+}
+
+// take refills key's bucket for the time elapsed and takes one token if there is one.
+func (l *rateLimiter) take(key string, now time.Time) rateDecision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	d := rateDecision{allowed: b.tokens >= 1}
+	if d.allowed {
+		b.tokens--
+	} else {
+		d.retryAfter = l.durationFor(1 - b.tokens)
+	}
+	d.remaining = int(b.tokens)
+	d.resetAfter = l.durationFor(l.burst - b.tokens)
+
+	return d
+}
+
+// durationFor is how long it takes to refill the given number of tokens.
+func (l *rateLimiter) durationFor(tokens float64) time.Duration {
+	return time.Duration(tokens / l.rate * float64(time.Second))
+}
+
+// sweep drops buckets that have refilled completely, since a fresh one is
+// identical. It runs at most once a minute. Callers must hold l.mu.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+
+	full := l.durationFor(l.burst)
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// rateLimitKeys returns the buckets a request draws from: its IP, plus its
+// caller when authenticated. The IP key never trusts X-Forwarded-For on its own.
+func rateLimitKeys(r *http.Request) []string {
+	keys := []string{"ip:" + clientIP(r)}
+
+	caller := callerFromContext(r.Context())
+	switch caller.Role {
+	case RoleAnonymous:
+	case RoleSupplier, RoleClient:
+		keys = append(keys, caller.Role+":"+caller.Email)
+	default:
+		keys = append(keys, caller.Role+":"+caller.Name)
+	}
+	return keys
+}
+
+// RateLimitHandler wrapper to rate limit POSTs to the wrapped route; other methods pass through.
+func RateLimitHandler(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if rateLimit == nil || r.Method != "POST" {
+			next(w, r)
+			return
+		}
+
+		// Report on the most constrained bucket
+		now := time.Now()
+		var worst rateDecision
+		for i, key := range rateLimitKeys(r) {
+			d := rateLimit.take(key, now)
+			if i == 0 || !d.allowed || (worst.allowed && d.remaining < worst.remaining) {
+				worst = d
+			}
+			if !d.allowed {
+				break
+			}
+		}
+
+		h := w.Header()
+		h.Set("X-RateLimit-Limit", strconv.Itoa(int(rateLimit.burst)))
+		h.Set("X-RateLimit-Remaining", strconv.Itoa(worst.remaining))
+		h.Set("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(worst.resetAfter.Seconds()))))
+
+		if !worst.allowed {
+			h.Set("Retry-After", strconv.Itoa(int(math.Ceil(worst.retryAfter.Seconds()))))
+			slog.WarnContext(r.Context(), "Rate limit exceeded", "ip", clientIP(r))
+			writeError(w, r, http.StatusTooManyRequests, "Rate limit exceeded; retry later")
+			return
+		}
+
+		next(w, r)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// --- Replay Protection for Signed Inbound Calls ---
+
+// replayTTL is how long a processed delivery is remembered. A signature older
+// than signatureMaxAge is rejected anyway, so nothing needs remembering longer.
+const replayTTL = signatureMaxAge + signatureClockSkew
+
+// replayEntry is the remembered outcome of one processed delivery.
+type replayEntry struct {
+	expires     time.Time
+	done        bool // false while the first delivery is still being handled
+	status      int
+	contentType string
+	body        []byte
+}
+
+// replayCache remembers processed deliveries so a replayed one is acknowledged
+// with the original response instead of being handled again. It is per
+// instance; replays routed to another instance are still caught by signature
+// expiry once the TTL has passed.
+type replayCache struct {
+	mu        sync.Mutex
+	entries   map[string]*replayEntry
+	lastSweep time.Time
+}
+
+// partnerReplays tracks deliveries from signed partner requests.
+var partnerReplays = &replayCache{entries: map[string]*replayEntry{}}
+
+// replayKey identifies a delivery: the partner's nonce when it sent one,
+// otherwise the signature itself, which is identical in a byte-for-byte replay.
+func replayKey(sig VerifiedSignature) string {
+	if sig.Nonce != "" {
+		return sig.Partner + ":nonce:" + sig.Nonce
+	}
+	return sig.Partner + ":sig:" + hex.EncodeToString(sig.Value)
+}
+
+// bufferedResponse captures a handler's response so it can be replayed later.
+type bufferedResponse struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) WriteHeader(code int) {
+	b.status = code
+	b.ResponseWriter.WriteHeader(code)
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	b.body.Write(p)
+	return b.ResponseWriter.Write(p)
+}
+
+// ServeOnce runs next for the first delivery with the given key. Later
+// deliveries within the TTL get the original response back (or 202 if the
+// first is still in flight) with an X-Replayed header, without running next,
+// unless the first ended without a final outcome.
+func (c *replayCache) ServeOnce(w http.ResponseWriter, r *http.Request, key string, next http.Handler) {
+	now := time.Now()
+
+	c.mu.Lock()
+	c.sweep(now)
+
+	if entry, ok := c.entries[key]; ok {
+		c.mu.Unlock()
+		slog.InfoContext(r.Context(), "Replayed delivery acknowledged without processing", "key", key)
+
+		w.Header().Set("X-Replayed", "true")
+		if !entry.done {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		if entry.contentType != "" {
+			w.Header().Set("Content-Type", entry.contentType)
+		}
+		w.WriteHeader(entry.status)
+		w.Write(entry.body)
+		return
+	}
+
+	entry := &replayEntry{expires: now.Add(replayTTL)}
+	c.entries[key] = entry
+	c.mu.Unlock()
+
+	// If next panics the entry would stay in flight until restart, answering
+	// every retry with 202; forget it instead, as for a server error
+	handled := false
+	defer func() {
+		if !handled {
+			c.mu.Lock()
+			delete(c.entries, key)
+			c.mu.Unlock()
+		}
+	}()
+
+	rec := &bufferedResponse{ResponseWriter: w, status: http.StatusOK}
+	next.ServeHTTP(rec, r)
+	handled = true
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Only a final outcome is remembered; anything the partner is meant to retry is forgotten
+	if !finalOutcome(rec.status) {
+		delete(c.entries, key)
+		return
+	}
+	entry.done = true
+	entry.status = rec.status
+	entry.contentType = rec.Header().Get("Content-Type")
+	entry.body = rec.body.Bytes()
+}
+
+// finalOutcome reports whether a response settles a delivery. Server errors,
+// timeouts and rate limiting mean it wasn't really processed, and the retry
+// they ask for must be handled rather than answered from the cache.
+func finalOutcome(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return false
+	}
+	return status < 500
+}
+
+// sweep drops expired entries, at most once a minute. Callers must hold c.mu.
+func (c *replayCache) sweep(now time.Time) {
+	if now.Sub(c.lastSweep) < time.Minute {
+		return
+	}
+	c.lastSweep = now
+
+	for key, entry := range c.entries {
+		if entry.done && now.After(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+}
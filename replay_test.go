@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServeOnce(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		wantReplay bool
+	}{
+		{name: "created", status: http.StatusCreated, wantReplay: true},
+		{name: "rejected", status: http.StatusBadRequest, wantReplay: true},
+		{name: "timed out", status: http.StatusRequestTimeout},
+		{name: "rate limited", status: http.StatusTooManyRequests},
+		{name: "server error", status: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := &replayCache{entries: map[string]*replayEntry{}}
+			runs := 0
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				runs++
+				w.WriteHeader(tt.status)
+			})
+
+			for i := 0; i < 2; i++ {
+				w := httptest.NewRecorder()
+				cache.ServeOnce(w, httptest.NewRequest("POST", "/requests", nil), "acme:nonce:1", next)
+				if w.Code != tt.status {
+					t.Fatalf("delivery %d: status %d, want %d", i+1, w.Code, tt.status)
+				}
+			}
+
+			wantRuns := 2
+			if tt.wantReplay {
+				wantRuns = 1
+			}
+			if runs != wantRuns {
+				t.Errorf("handler ran %d times, want %d", runs, wantRuns)
+			}
+		})
+	}
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- HTTP Message Signatures (RFC 9421) for Partners ---
+
+// signatureMaxAge bounds how old a signature's "created" time may be, and the
+// allowed clock skew into the future.
+const (
+	signatureMaxAge    = 5 * time.Minute
+	signatureClockSkew = 30 * time.Second
+)
+
+// requiredSignedComponents must be covered by every partner signature, so a
+// signature can't be lifted onto a different method, URL or body.
+var requiredSignedComponents = []string{"@method", "@target-uri", "content-digest"}
+
+// PartnerKey is one entry of the PARTNER_KEYS_FILE. Key is base64: the raw
+// 32-byte public key for ed25519, or the shared secret for hmac-sha256.
+type PartnerKey struct {
+	KeyID   string `json:"key_id"`
+	Partner string `json:"partner"`
+	Alg     string `json:"alg"` // "ed25519" or "hmac-sha256"
+	Key     string `json:"key"`
+
+	raw []byte
+}
+
+// partnerKeys maps key IDs to partner keys. It is nil when signing is disabled.
+var partnerKeys map[string]PartnerKey
+
+// requireSignedPosts rejects unsigned POSTs, for deployments where only partners write.
+var requireSignedPosts = os.Getenv("REQUIRE_SIGNED_POSTS") == "true"
+
+// loadPartnerKeys reads the key file named by PARTNER_KEYS_FILE, if set.
+func loadPartnerKeys() error {
+	path := os.Getenv("PARTNER_KEYS_FILE")
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var file struct {
+		Keys []PartnerKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	keys := make(map[string]PartnerKey, len(file.Keys))
+	for _, k := range file.Keys {
+		raw, err := base64.StdEncoding.DecodeString(k.Key)
+		if err != nil {
+			return fmt.Errorf("key %q: invalid base64: %w", k.KeyID, err)
+		}
+		switch k.Alg {
+		case "ed25519":
+			if len(raw) != ed25519.PublicKeySize {
+				return fmt.Errorf("key %q: ed25519 public key must be %d bytes", k.KeyID, ed25519.PublicKeySize)
+			}
+		case "hmac-sha256":
+		default:
+			return fmt.Errorf("key %q: unsupported alg %q", k.KeyID, k.Alg)
+		}
+		k.raw = raw
+		keys[k.KeyID] = k
+	}
+
+	partnerKeys = keys
+	return nil
+}
+
+// VerifiedSignature describes a partner signature that passed verification.
+type VerifiedSignature struct {
+	Partner string
+	KeyID   string
+	Nonce   string
+	Created time.Time
+	Value   []byte // The raw signature bytes
+}
+
+// partnerSignatureKey is the context key for the VerifiedSignature of a request.
+type partnerSignatureKey struct{}
+
+// partnerSignatureFromContext returns the verified partner signature, if the request had one.
+func partnerSignatureFromContext(ctx context.Context) (VerifiedSignature, bool) {
+	sig, ok := ctx.Value(partnerSignatureKey{}).(VerifiedSignature)
+	return sig, ok
+}
+
+// SignatureHandler verifies partner signatures on inbound POSTs. Signed POSTs
+// must verify; unsigned POSTs are rejected only when REQUIRE_SIGNED_POSTS is set.
+func SignatureHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || partnerKeys == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.Header.Get("Signature-Input") == "" {
+			if requireSignedPosts {
+				writeError(w, r, http.StatusUnauthorized, "Signature required")
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Buffer the body so the digest can be checked and the handler can still read it
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes))
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "Invalid request body: "+err.Error())
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		sig, err := verifyRequestSignature(r, body, time.Now())
+		if err != nil {
+			slog.InfoContext(r.Context(), "Rejected partner signature", "err", err)
+			writeError(w, r, http.StatusUnauthorized, "Invalid signature: "+err.Error())
+			return
+		}
+
+		// Acknowledge replayed deliveries without processing them again
+		ctx := context.WithValue(r.Context(), partnerSignatureKey{}, sig)
+		partnerReplays.ServeOnce(w, r.WithContext(ctx), replayKey(sig), next)
+	})
+}
+
+// verifyRequestSignature checks the Content-Digest and each signature in the
+// request, returning the first one made with a known partner key.
+func verifyRequestSignature(r *http.Request, body []byte, now time.Time) (VerifiedSignature, error) {
+	if err := verifyContentDigest(r.Header.Get("Content-Digest"), body); err != nil {
+		return VerifiedSignature{}, err
+	}
+
+	inputs := parseDictionary(r.Header.Get("Signature-Input"))
+	signatures := parseDictionary(r.Header.Get("Signature"))
+
+	lastErr := errors.New("no signature with a known key id")
+	for label, params := range inputs {
+		sigValue, ok := signatures[label]
+		if !ok {
+			lastErr = fmt.Errorf("signature %q has no value", label)
+			continue
+		}
+
+		sig, err := verifySignature(r, params, sigValue, now)
+		if err != nil {
+			lastErr = fmt.Errorf("signature %q: %w", label, err)
+			continue
+		}
+		return sig, nil
+	}
+
+	return VerifiedSignature{}, lastErr
+}
+
+// verifySignature verifies one labelled signature. params is the raw member
+// of Signature-Input, e.g. `("@method" "@target-uri");created=1;keyid="k"`.
+func verifySignature(r *http.Request, params, sigValue string, now time.Time) (VerifiedSignature, error) {
+	components, attrs, err := parseSignatureParams(params)
+	if err != nil {
+		return VerifiedSignature{}, err
+	}
+
+	key, ok := partnerKeys[attrs["keyid"]]
+	if !ok {
+		return VerifiedSignature{}, fmt.Errorf("unknown key id %q", attrs["keyid"])
+	}
+	if alg := attrs["alg"]; alg != "" && alg != key.Alg {
+		return VerifiedSignature{}, fmt.Errorf("alg %q does not match key", alg)
+	}
+
+	// 1. Freshness: created is mandatory, expires is honoured when present
+	createdUnix, err := strconv.ParseInt(attrs["created"], 10, 64)
+	if err != nil {
+		return VerifiedSignature{}, errors.New("missing or invalid created parameter")
+	}
+	created := time.Unix(createdUnix, 0)
+	if now.Sub(created) > signatureMaxAge || created.Sub(now) > signatureClockSkew {
+		return VerifiedSignature{}, errors.New("signature expired")
+	}
+	if exp := attrs["expires"]; exp != "" {
+		expUnix, err := strconv.ParseInt(exp, 10, 64)
+		if err != nil || now.After(time.Unix(expUnix, 0)) {
+			return VerifiedSignature{}, errors.New("signature expired")
+		}
+	}
+
+	// 2. Coverage: the signature must bind method, URL and body
+	covered := map[string]bool{}
+	for _, c := range components {
+		covered[c] = true
+	}
+	for _, c := range requiredSignedComponents {
+		if !covered[c] {
+			return VerifiedSignature{}, fmt.Errorf("signature must cover %q", c)
+		}
+	}
+
+	// 3. Rebuild the signature base and check it against the key
+	base, err := signatureBase(r, components, params)
+	if err != nil {
+		return VerifiedSignature{}, err
+	}
+
+	sig, err := byteSequence(sigValue)
+	if err != nil {
+		return VerifiedSignature{}, err
+	}
+
+	switch key.Alg {
+	case "ed25519":
+		if !ed25519.Verify(ed25519.PublicKey(key.raw), []byte(base), sig) {
+			return VerifiedSignature{}, errors.New("verification failed")
+		}
+	case "hmac-sha256":
+		mac := hmac.New(sha256.New, key.raw)
+		mac.Write([]byte(base))
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return VerifiedSignature{}, errors.New("verification failed")
+		}
+	}
+
+	return VerifiedSignature{Partner: key.Partner, KeyID: key.KeyID, Nonce: attrs["nonce"], Created: created, Value: sig}, nil
+}
+
+// signatureBase builds the RFC 9421 signature base for the covered components.
+func signatureBase(r *http.Request, components []string, params string) (string, error) {
+	var b strings.Builder
+
+	for _, c := range components {
+		value, err := componentValue(r, c)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "%q: %s\n", c, value)
+	}
+	fmt.Fprintf(&b, "%q: %s", "@signature-params", params)
+
+	return b.String(), nil
+}
+
+// componentValue resolves a derived component or header field for the signature base.
+func componentValue(r *http.Request, name string) (string, error) {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+
+	switch name {
+	case "@method":
+		return r.Method, nil
+	case "@scheme":
+		return scheme, nil
+	case "@authority":
+		return strings.ToLower(r.Host), nil
+	case "@target-uri":
+		return scheme + "://" + strings.ToLower(r.Host) + r.URL.RequestURI(), nil
+	case "@path":
+		return r.URL.EscapedPath(), nil
+	case "@query":
+		return "?" + r.URL.RawQuery, nil
+	}
+
+	if strings.HasPrefix(name, "@") {
+		return "", fmt.Errorf("unsupported derived component %q", name)
+	}
+
+	values := r.Header.Values(name)
+	if len(values) == 0 {
+		return "", fmt.Errorf("covered header %q is missing", name)
+	}
+	for i := range values {
+		values[i] = strings.TrimSpace(values[i])
+	}
+	return strings.Join(values, ", "), nil
+}
+
+// verifyContentDigest checks a Content-Digest header (RFC 9530) against the body.
+func verifyContentDigest(header string, body []byte) error {
+	if header == "" {
+		return errors.New("missing Content-Digest")
+	}
+
+	for alg, value := range parseDictionary(header) {
+		want, err := byteSequence(value)
+		if err != nil {
+			return err
+		}
+
+		var got []byte
+		switch alg {
+		case "sha-256":
+			sum := sha256.Sum256(body)
+			got = sum[:]
+		case "sha-512":
+			sum := sha512.Sum512(body)
+			got = sum[:]
+		default:
+			continue
+		}
+
+		if !hmac.Equal(got, want) {
+			return errors.New("Content-Digest does not match body")
+		}
+		return nil
+	}
+
+	return errors.New("Content-Digest has no supported algorithm")
+}
+
+// parseSignatureParams splits a Signature-Input member into its covered
+// component names and its parameters.
+func parseSignatureParams(params string) ([]string, map[string]string, error) {
+	if !strings.HasPrefix(params, "(") {
+		return nil, nil, errors.New("malformed Signature-Input")
+	}
+	end := strings.Index(params, ")")
+	if end < 0 {
+		return nil, nil, errors.New("malformed Signature-Input")
+	}
+
+	var components []string
+	for _, item := range strings.Fields(params[1:end]) {
+		name, err := strconv.Unquote(item)
+		if err != nil {
+			return nil, nil, fmt.Errorf("malformed component %s", item)
+		}
+		components = append(components, name)
+	}
+
+	attrs := map[string]string{}
+	for _, p := range splitTopLevel(params[end+1:], ';') {
+		k, v, _ := strings.Cut(p, "=")
+		if unquoted, err := strconv.Unquote(v); err == nil {
+			v = unquoted
+		}
+		attrs[strings.TrimSpace(k)] = v
+	}
+
+	return components, attrs, nil
+}
+
+// parseDictionary splits a structured-field dictionary into raw member values
+// keyed by name, e.g. `a=1, b=("x");p=2` -> {"a": "1", "b": `("x");p=2`}.
+func parseDictionary(s string) map[string]string {
+	members := map[string]string{}
+	for _, m := range splitTopLevel(s, ',') {
+		k, v, ok := strings.Cut(m, "=")
+		if !ok {
+			continue
+		}
+		members[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return members
+}
+
+// splitTopLevel splits s on sep, ignoring separators inside quotes or parentheses.
+func splitTopLevel(s string, sep byte) []string {
+	var parts []string
+	depth, inQuotes, start := 0, false, 0
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && inQuotes:
+			i++
+		case c == '"':
+			inQuotes = !inQuotes
+		case c == '(' && !inQuotes:
+			depth++
+		case c == ')' && !inQuotes:
+			depth--
+		case c == sep && !inQuotes && depth == 0:
+			if part := strings.TrimSpace(s[start:i]); part != "" {
+				parts = append(parts, part)
+			}
+			start = i + 1
+		}
+	}
+	if part := strings.TrimSpace(s[start:]); part != "" {
+		parts = append(parts, part)
+	}
+
+	return parts
+}
+
+// byteSequence decodes a structured-field byte sequence, i.e. `:base64:`.
+func byteSequence(v string) ([]byte, error) {
+	if len(v) < 2 || v[0] != ':' || v[len(v)-1] != ':' {
+		return nil, errors.New("malformed byte sequence")
+	}
+	return base64.StdEncoding.DecodeString(v[1 : len(v)-1])
+}
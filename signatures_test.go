@@ -0,0 +1,201 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignatureBase(t *testing.T) {
+	r := httptest.NewRequest("POST", "https://API.example.com/requests?x=1&y=2", nil)
+	r.Header.Set("Content-Digest", "sha-256=:abc=:")
+	r.Header.Add("X-Multi", " one ")
+	r.Header.Add("X-Multi", "two")
+
+	params := `("@method" "@target-uri" "content-digest");created=1700000000;keyid="k"`
+
+	tests := []struct {
+		name       string
+		components []string
+		want       string
+		wantErr    bool
+	}{
+		{
+			name:       "method, target and digest",
+			components: []string{"@method", "@target-uri", "content-digest"},
+			want: `"@method": POST` + "\n" +
+				`"@target-uri": https://api.example.com/requests?x=1&y=2` + "\n" +
+				`"content-digest": sha-256=:abc=:` + "\n" +
+				`"@signature-params": ` + params,
+		},
+		{
+			name:       "authority, path and query",
+			components: []string{"@authority", "@path", "@query"},
+			want: `"@authority": api.example.com` + "\n" +
+				`"@path": /requests` + "\n" +
+				`"@query": ?x=1&y=2` + "\n" +
+				`"@signature-params": ` + params,
+		},
+		{
+			name:       "repeated header is joined and trimmed",
+			components: []string{"x-multi"},
+			want:       `"x-multi": one, two` + "\n" + `"@signature-params": ` + params,
+		},
+		{name: "missing header", components: []string{"x-absent"}, wantErr: true},
+		{name: "unsupported derived component", components: []string{"@request-response"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := signatureBase(r, tt.components, params)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got base %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("base mismatch\ngot:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyContentDigest(t *testing.T) {
+	body := []byte(`{"gig_title":"g"}`)
+	sum := sha256.Sum256(body)
+	digest := "sha-256=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"
+
+	tests := []struct {
+		name    string
+		header  string
+		body    []byte
+		wantErr bool
+	}{
+		{name: "matching sha-256", header: digest, body: body},
+		{name: "tampered body", header: digest, body: []byte(`{"gig_title":"x"}`), wantErr: true},
+		{name: "tampered digest", header: "sha-256=:" + base64.StdEncoding.EncodeToString(make([]byte, 32)) + ":", body: body, wantErr: true},
+		{name: "missing", header: "", body: body, wantErr: true},
+		{name: "unsupported algorithm only", header: "md5=:AAAA:", body: body, wantErr: true},
+		{name: "not a byte sequence", header: "sha-256=abc", body: body, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyContentDigest(tt.header, tt.body)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// signedRequest builds a partner request signed over the given components,
+// with a Content-Digest for digestBody (normally the body itself).
+func signedRequest(t *testing.T, body, digestBody string, components []string, keyID string, created time.Time, sign func(base string) []byte) *http.Request {
+	t.Helper()
+
+	r := httptest.NewRequest("POST", "https://api.example.com/requests", strings.NewReader(body))
+	sum := sha256.Sum256([]byte(digestBody))
+	r.Header.Set("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(sum[:])+":")
+
+	quoted := make([]string, len(components))
+	for i, c := range components {
+		quoted[i] = strconv.Quote(c)
+	}
+	params := "(" + strings.Join(quoted, " ") + ");created=" + strconv.FormatInt(created.Unix(), 10) + `;keyid="` + keyID + `"`
+
+	base, err := signatureBase(r, components, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Signature-Input", "sig1="+params)
+	r.Header.Set("Signature", "sig1=:"+base64.StdEncoding.EncodeToString(sign(base))+":")
+	return r
+}
+
+func TestVerifyRequestSignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := []byte("partner-secret")
+
+	saved := partnerKeys
+	t.Cleanup(func() { partnerKeys = saved })
+	partnerKeys = map[string]PartnerKey{
+		"ed": {KeyID: "ed", Partner: "acme", Alg: "ed25519", raw: pub},
+		"hm": {KeyID: "hm", Partner: "globex", Alg: "hmac-sha256", raw: secret},
+	}
+
+	signEd := func(base string) []byte { return ed25519.Sign(priv, []byte(base)) }
+	signHMAC := func(base string) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(base))
+		return mac.Sum(nil)
+	}
+
+	now := time.Now()
+	body := `{"gig_title":"g"}`
+	all := requiredSignedComponents
+
+	tests := []struct {
+		name        string
+		r           *http.Request
+		body        string // Body as received, if different from what was signed
+		wantPartner string
+	}{
+		{name: "ed25519", r: signedRequest(t, body, body, all, "ed", now, signEd), wantPartner: "acme"},
+		{name: "hmac-sha256", r: signedRequest(t, body, body, all, "hm", now, signHMAC), wantPartner: "globex"},
+		{name: "body changed after signing", r: signedRequest(t, body, body, all, "ed", now, signEd), body: `{"gig_title":"x"}`},
+		{name: "digest recomputed for another body", r: func() *http.Request {
+			r := signedRequest(t, body, body, all, "ed", now, signEd)
+			sum := sha256.Sum256([]byte(`{"gig_title":"x"}`))
+			r.Header.Set("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(sum[:])+":")
+			return r
+		}(), body: `{"gig_title":"x"}`},
+		{name: "digest not covered", r: signedRequest(t, body, body, []string{"@method", "@target-uri"}, "ed", now, signEd)},
+		{name: "signed with another key", r: signedRequest(t, body, body, all, "ed", now, signHMAC)},
+		{name: "unknown key id", r: signedRequest(t, body, body, all, "nope", now, signEd)},
+		{name: "too old", r: signedRequest(t, body, body, all, "ed", now.Add(-signatureMaxAge-time.Minute), signEd)},
+		{name: "from the future", r: signedRequest(t, body, body, all, "ed", now.Add(signatureClockSkew+time.Minute), signEd)},
+		{name: "method changed after signing", r: func() *http.Request {
+			r := signedRequest(t, body, body, all, "ed", now, signEd)
+			r.Method = "PUT"
+			return r
+		}()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received := body
+			if tt.body != "" {
+				received = tt.body
+			}
+
+			sig, err := verifyRequestSignature(tt.r, []byte(received), now)
+			if tt.wantPartner == "" {
+				if err == nil {
+					t.Fatalf("verified as %q, want rejection", sig.Partner)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sig.Partner != tt.wantPartner {
+				t.Errorf("partner = %q, want %q", sig.Partner, tt.wantPartner)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+)
+
+// --- Request Status Lifecycle ---
+
+// Status is where a gig request is in its lifecycle.
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusAccepted  Status = "accepted"
+	StatusDeclined  Status = "declined"
+	StatusCompleted Status = "completed"
+)
+
+// statusTransitions lists the legal next states for each status. Declined and
+// completed are terminal.
+var statusTransitions = map[Status][]Status{
+	StatusPending:  {StatusAccepted, StatusDeclined},
+	StatusAccepted: {StatusCompleted},
+}
+
+// validStatus reports whether s is one of the known statuses.
+func validStatus(s Status) bool {
+	switch s {
+	case StatusPending, StatusAccepted, StatusDeclined, StatusCompleted:
+		return true
+	}
+	return false
+}
+
+// canTransition reports whether a request may move from one status to another.
+func canTransition(from, to Status) bool {
+	for _, next := range statusTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// canChangeStatus reports whether the caller may move a request it can access
+// through its lifecycle. That is the supplier's decision (or an admin's), so
+// clients and partners can't accept or complete requests themselves.
+func (c Caller) canChangeStatus() bool {
+	switch c.Role {
+	case RoleSupplier:
+		return true // loadRequest has already checked it is theirs
+	case RoleAnonymous:
+		return !requireAPIKeys
+	default:
+		return c.isAdmin()
+	}
+}
+
+// statusChange is the body of POST /requests/{id}/status.
+type statusChange struct {
+	Status Status `json:"status"`
+}
+
+// changeRequestStatus handles POST /requests/{id}/status, moving the request to
+// a new status if the transition is legal and the caller may make it.
+func changeRequestStatus(w http.ResponseWriter, r *http.Request, id int) {
+	if r.Method != "POST" {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	req, ok := loadRequest(w, r, id, false)
+	if !ok {
+		return
+	}
+	if caller := callerFromContext(r.Context()); !caller.canChangeStatus() {
+		writeError(w, r, http.StatusForbidden, "Forbidden: only the request's supplier or an admin can change its status")
+		return
+	}
+
+	var change statusChange
+	if !decodeJSONBody(w, r, &change) {
+		return
+	}
+
+	if !validStatus(change.Status) {
+		writeAPIError(w, r, http.StatusBadRequest, APIError{
+			Code:    codeValidationFailed,
+			Message: "Invalid status: must be one of pending, accepted, declined, completed",
+			Details: map[string]string{"status": "must be one of pending, accepted, declined, completed"},
+		})
+		return
+	}
+	if !canTransition(req.Status, change.Status) {
+		writeAPIError(w, r, http.StatusConflict, APIError{
+			Code:    codeInvalidTransition,
+			Message: "Cannot change status from " + string(req.Status) + " to " + string(change.Status),
+		})
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Request status changing", "id", req.ID, "from", req.Status, "to", change.Status)
+	req.Status = change.Status
+
+	saveUpdatedRequest(w, r, req)
+}
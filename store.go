@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// --- Storage Backends ---
+
+// ErrNotFound is returned by a Store when no request has the given ID.
+var ErrNotFound = errors.New("request not found")
+
+// ListFilter narrows the requests returned by Store.List. Zero values mean "no filter".
+type ListFilter struct {
+	SupplierEmail  string
+	ClientEmail    string
+	Status         Status
+	CreatedAfter   time.Time // Exclusive lower bound on CreatedAt
+	CreatedBefore  time.Time // Exclusive upper bound on CreatedAt
+	IncludeDeleted bool      // Include soft-deleted requests
+
+	// SearchTerms must each appear (case-insensitively) in the gig title, client or details.
+	SearchTerms []string
+
+	// SortBy is one of SortFields ("" means "id"); Descending reverses the order.
+	SortBy     string
+	Descending bool
+
+	// Limit and Offset select a page of the matching requests; Limit 0 means no limit.
+	Limit  int
+	Offset int
+}
+
+// maxSearchTerms caps the number of words in a ?q= search.
+const maxSearchTerms = 10
+
+// searchTerms splits a search query into lowercase words.
+func searchTerms(q string) []string {
+	return strings.Fields(strings.ToLower(q))
+}
+
+// SortFields are the request fields List can order by, in the order they are
+// listed in error messages.
+var SortFields = []string{"id", "created_at", "gig_title", "client"}
+
+// validSortField reports whether field is one of SortFields.
+func validSortField(field string) bool {
+	for _, f := range SortFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Store is the persistence layer for gig requests. Handlers only talk to a
+// Store, so backends can be swapped without touching HTTP code.
+type Store interface {
+	// Create saves a new request, assigning its ID, and returns the stored record.
+	Create(ctx context.Context, req Request) (Request, error)
+	// CreateMany saves several new requests atomically: either all are stored,
+	// with IDs assigned in order, or none are.
+	CreateMany(ctx context.Context, reqs []Request) ([]Request, error)
+	// List returns a page of the requests matching filter, ordered by
+	// filter.SortBy (ID by default), along with the total number of matches before paging.
+	List(ctx context.Context, filter ListFilter) ([]Request, int, error)
+	// Get returns the request with the given ID, or ErrNotFound.
+	Get(ctx context.Context, id int) (Request, error)
+	// Update replaces the stored request with the same ID, or returns ErrNotFound.
+	Update(ctx context.Context, req Request) (Request, error)
+	// Delete removes the request with the given ID, or returns ErrNotFound.
+	Delete(ctx context.Context, id int) error
+}
+
+// storageBackend names the backend chosen by openStore, reported on /version.
+var storageBackend = "memory"
+
+// openStore picks the storage backend from the environment. STORAGE selects
+// "memory", "postgres" or "sqlite"; when unset, Postgres is used if
+// DATABASE_URL is set and the in-memory store otherwise.
+func openStore(ctx context.Context) (Store, error) {
+	backend := os.Getenv("STORAGE")
+	if backend == "" {
+		backend = "memory"
+		if os.Getenv("DATABASE_URL") != "" {
+			backend = "postgres"
+		}
+	}
+	storageBackend = backend
+
+	switch backend {
+	case "memory":
+		return newMemoryStore(), nil
+	case "postgres":
+		dsn := os.Getenv("DATABASE_URL")
+		if dsn == "" {
+			return nil, fmt.Errorf("STORAGE=postgres requires DATABASE_URL")
+		}
+		return newPostgresStore(ctx, dsn)
+	case "sqlite":
+		path := os.Getenv("STORAGE_PATH")
+		if path == "" {
+			path = "data.db"
+		}
+		return newSQLiteStore(ctx, path)
+	default:
+		return nil, fmt.Errorf("unknown STORAGE %q (want memory, postgres or sqlite)", backend)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// memoryStore keeps requests in a slice. It is the default backend; data is
+// lost on restart and is not shared between instances.
+type memoryStore struct {
+	mu       sync.Mutex // Mutex to protect the requests slice from concurrent access
+	requests []Request
+	nextID   int
+}
+
+// newMemoryStore returns an empty in-memory store.
+func newMemoryStore() *memoryStore {
+	return &memoryStore{nextID: 1}
+}
+
+func (s *memoryStore) Create(ctx context.Context, req Request) (Request, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	req.ID = s.nextID
+	s.nextID++
+	s.requests = append(s.requests, req)
+
+	return req, nil
+}
+
+func (s *memoryStore) CreateMany(ctx context.Context, reqs []Request) ([]Request, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	created := make([]Request, len(reqs))
+	for i, req := range reqs {
+		req.ID = s.nextID
+		s.nextID++
+		created[i] = req
+	}
+	s.requests = append(s.requests, created...)
+
+	return created, nil
+}
+
+func (s *memoryStore) List(ctx context.Context, filter ListFilter) ([]Request, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := []Request{}
+	for _, req := range s.requests {
+		if filter.SupplierEmail != "" && req.SupplierEmail != filter.SupplierEmail {
+			continue
+		}
+		if filter.ClientEmail != "" && req.ClientEmail != filter.ClientEmail {
+			continue
+		}
+		if filter.Status != "" && req.Status != filter.Status {
+			continue
+		}
+		if !filter.CreatedAfter.IsZero() && !req.CreatedAt.After(filter.CreatedAfter) {
+			continue
+		}
+		if !filter.CreatedBefore.IsZero() && !req.CreatedAt.Before(filter.CreatedBefore) {
+			continue
+		}
+		if req.DeletedAt != nil && !filter.IncludeDeleted {
+			continue
+		}
+		if !matchesSearch(req, filter.SearchTerms) {
+			continue
+		}
+		result = append(result, req)
+	}
+
+	sortRequests(result, filter.SortBy, filter.Descending)
+
+	total := len(result)
+	if filter.Offset >= total {
+		return []Request{}, total, nil
+	}
+	result = result[filter.Offset:]
+	if filter.Limit > 0 && filter.Limit < len(result) {
+		result = result[:filter.Limit]
+	}
+
+	return result, total, nil
+}
+
+func (s *memoryStore) Get(ctx context.Context, id int) (Request, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if i := s.indexOf(id); i >= 0 {
+		return s.requests[i], nil
+	}
+	return Request{}, ErrNotFound
+}
+
+func (s *memoryStore) Update(ctx context.Context, req Request) (Request, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.indexOf(req.ID)
+	if i < 0 {
+		return Request{}, ErrNotFound
+	}
+	s.requests[i] = req
+
+	return req, nil
+}
+
+func (s *memoryStore) Delete(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.indexOf(id)
+	if i < 0 {
+		return ErrNotFound
+	}
+	s.requests = append(s.requests[:i], s.requests[i+1:]...)
+
+	return nil
+}
+
+// indexOf returns the slice position of the request with the given ID, or -1.
+// Callers must hold s.mu.
+func (s *memoryStore) indexOf(id int) int {
+	for i, req := range s.requests {
+		if req.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// matchesSearch reports whether every term appears in the request's title, client or details.
+func matchesSearch(req Request, terms []string) bool {
+	if len(terms) == 0 {
+		return true
+	}
+
+	text := strings.ToLower(req.GigTitle + "\n" + req.Client + "\n" + req.Details)
+	for _, term := range terms {
+		if !strings.Contains(text, term) {
+			return false
+		}
+	}
+	return true
+}
+
+// sortRequests orders requests by the given field, breaking ties by ID.
+func sortRequests(reqs []Request, field string, descending bool) {
+	less := func(a, b Request) bool {
+		switch field {
+		case "created_at":
+			if !a.CreatedAt.Equal(b.CreatedAt) {
+				return a.CreatedAt.Before(b.CreatedAt)
+			}
+		case "gig_title":
+			if a.GigTitle != b.GigTitle {
+				return a.GigTitle < b.GigTitle
+			}
+		case "client":
+			if a.Client != b.Client {
+				return a.Client < b.Client
+			}
+		}
+		return a.ID < b.ID
+	}
+
+	sort.SliceStable(reqs, func(i, j int) bool {
+		if descending {
+			return less(reqs[j], reqs[i])
+		}
+		return less(reqs[i], reqs[j])
+	})
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib" // Registers the "pgx" database/sql driver
+)
+
+// postgresDialect is the schema and SQL flavour of the Postgres backend.
+var postgresDialect = sqlDialect{
+	name: "postgres",
+	migrations: []string{
+		`CREATE TABLE requests (
+			id             SERIAL PRIMARY KEY,
+			gig_title      TEXT NOT NULL,
+			client         TEXT NOT NULL,
+			client_email   TEXT NOT NULL,
+			supplier_email TEXT NOT NULL,
+			details        TEXT NOT NULL DEFAULT '',
+			consent        JSONB,
+			created_at     TIMESTAMPTZ NOT NULL
+		)`,
+		`CREATE INDEX requests_supplier_email_idx ON requests (supplier_email)`,
+		`ALTER TABLE requests ADD COLUMN deleted_at TIMESTAMPTZ`,
+		`ALTER TABLE requests ADD COLUMN status TEXT NOT NULL DEFAULT 'pending'`,
+		`CREATE INDEX requests_status_idx ON requests (status)`,
+		`CREATE TABLE api_keys (
+			id             SERIAL PRIMARY KEY,
+			supplier_email TEXT NOT NULL,
+			prefix         TEXT NOT NULL,
+			key_hash       TEXT NOT NULL UNIQUE,
+			created_at     TIMESTAMPTZ NOT NULL,
+			revoked_at     TIMESTAMPTZ
+		)`,
+		`CREATE INDEX api_keys_supplier_email_idx ON api_keys (supplier_email)`,
+		`CREATE TABLE webhooks (
+			id             SERIAL PRIMARY KEY,
+			supplier_email TEXT NOT NULL,
+			url            TEXT NOT NULL,
+			events         TEXT NOT NULL,
+			secret         TEXT NOT NULL,
+			created_at     TIMESTAMPTZ NOT NULL
+		)`,
+		`CREATE INDEX webhooks_supplier_email_idx ON webhooks (supplier_email)`,
+	},
+	noLimit: "ALL",
+	migrationsTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INT PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+	lockMigrations: `SELECT pg_advisory_xact_lock(7310001)`,
+	// The database's default collation may ignore case and punctuation
+	byteOrder: `COLLATE "C"`,
+}
+
+// newPostgresStore connects to dsn, configures the pool from DB_* environment
+// variables and brings the schema up to date.
+func newPostgresStore(ctx context.Context, dsn string) (*sqlStore, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("opening postgres: %w", err)
+	}
+
+	db.SetMaxOpenConns(envInt("DB_MAX_OPEN_CONNS", 10))
+	db.SetMaxIdleConns(envInt("DB_MAX_IDLE_CONNS", 5))
+	db.SetConnMaxLifetime(30 * time.Minute)
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connecting to postgres: %w", err)
+	}
+
+	s := &sqlStore{db: db, dialect: postgresDialect}
+	if err := s.migrate(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrating postgres schema: %w", err)
+	}
+
+	return s, nil
+}
+
+// envInt reads a positive integer environment variable, falling back to def.
+func envInt(name string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(name)); err == nil && v > 0 {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// sqlDialect captures the differences between the database/sql backends.
+// Queries are written with Postgres-style $N placeholders and rebound per dialect.
+type sqlDialect struct {
+	name string
+	// migrations are applied in order; each entry's index+1 is its version.
+	// Never edit an entry once it has shipped - append a new one instead.
+	migrations []string
+	// migrationsTable creates the schema_migrations bookkeeping table.
+	migrationsTable string
+	// lockMigrations, if set, runs first inside the migration transaction so
+	// concurrently starting instances don't race each other.
+	lockMigrations string
+	// rebind converts $N placeholders to the dialect's syntax.
+	rebind func(query string) string
+	// timeArg, if set, converts time values before they are bound as arguments.
+	timeArg func(t time.Time) any
+	// noLimit is the LIMIT value meaning "all rows", needed before a bare OFFSET.
+	noLimit string
+	// byteOrder is the COLLATE clause that sorts text by byte value, as the
+	// memory store does, whatever collation the database was created with.
+	byteOrder string
+}
+
+// sqlStore persists requests through database/sql. Postgres and SQLite share
+// it, differing only in their sqlDialect.
+type sqlStore struct {
+	db      *sql.DB
+	dialect sqlDialect
+}
+
+// migrate applies any migrations newer than the recorded schema version.
+func (s *sqlStore) migrate(ctx context.Context) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if s.dialect.lockMigrations != "" {
+		if _, err := tx.ExecContext(ctx, s.dialect.lockMigrations); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, s.dialect.migrationsTable); err != nil {
+		return err
+	}
+
+	var current int
+	if err := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return err
+	}
+
+	for i := current; i < len(s.dialect.migrations); i++ {
+		if _, err := tx.ExecContext(ctx, s.dialect.migrations[i]); err != nil {
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		if _, err := tx.ExecContext(ctx, s.q(`INSERT INTO schema_migrations (version) VALUES ($1)`), i+1); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// t converts a time for binding as a query argument.
+func (s *sqlStore) t(t time.Time) any {
+	if s.dialect.timeArg == nil {
+		return t
+	}
+	return s.dialect.timeArg(t)
+}
+
+// tp converts an optional time for binding, keeping nil as SQL NULL.
+func (s *sqlStore) tp(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return s.t(*t)
+}
+
+// q rebinds a query's placeholders for the store's dialect.
+func (s *sqlStore) q(query string) string {
+	if s.dialect.rebind == nil {
+		return query
+	}
+	return s.dialect.rebind(query)
+}
+
+const sqlRequestColumns = `id, gig_title, client, client_email, supplier_email, details, status, consent, created_at, deleted_at`
+
+// likeEscaper escapes LIKE wildcards so search terms match literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanRequest reads one row selected with sqlRequestColumns.
+func scanRequest(row rowScanner) (Request, error) {
+	var req Request
+	var consent []byte
+	var deletedAt sql.NullTime
+
+	if err := row.Scan(&req.ID, &req.GigTitle, &req.Client, &req.ClientEmail, &req.SupplierEmail, &req.Details, &req.Status, &consent, &req.CreatedAt, &deletedAt); err != nil {
+		return Request{}, err
+	}
+
+	if deletedAt.Valid {
+		req.DeletedAt = &deletedAt.Time
+	}
+
+	if consent != nil {
+		req.Consent = &Consent{}
+		if err := json.Unmarshal(consent, req.Consent); err != nil {
+			return Request{}, fmt.Errorf("decoding consent for request %d: %w", req.ID, err)
+		}
+	}
+
+	return req, nil
+}
+
+// consentValue encodes a request's consent for a nullable JSON column.
+func consentValue(c *Consent) (any, error) {
+	if c == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// sqlQuerier is satisfied by both *sql.DB and *sql.Tx.
+type sqlQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func (s *sqlStore) Create(ctx context.Context, req Request) (Request, error) {
+	return s.insert(ctx, s.db, req)
+}
+
+func (s *sqlStore) CreateMany(ctx context.Context, reqs []Request) ([]Request, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	created := make([]Request, len(reqs))
+	for i, req := range reqs {
+		if created[i], err = s.insert(ctx, tx, req); err != nil {
+			return nil, fmt.Errorf("row %d: %w", i+1, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// insert stores one new request through db, which may be a transaction.
+func (s *sqlStore) insert(ctx context.Context, db sqlQuerier, req Request) (Request, error) {
+	consent, err := consentValue(req.Consent)
+	if err != nil {
+		return Request{}, err
+	}
+
+	err = db.QueryRowContext(ctx, s.q(
+		`INSERT INTO requests (gig_title, client, client_email, supplier_email, details, status, consent, created_at, deleted_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`),
+		req.GigTitle, req.Client, req.ClientEmail, req.SupplierEmail, req.Details, req.Status, consent, s.t(req.CreatedAt), s.tp(req.DeletedAt),
+	).Scan(&req.ID)
+	if err != nil {
+		return Request{}, err
+	}
+
+	return req, nil
+}
+
+func (s *sqlStore) List(ctx context.Context, filter ListFilter) ([]Request, int, error) {
+	var conds []string
+	var args []any
+
+	if filter.SupplierEmail != "" {
+		args = append(args, filter.SupplierEmail)
+		conds = append(conds, fmt.Sprintf("supplier_email = $%d", len(args)))
+	}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		conds = append(conds, fmt.Sprintf("status = $%d", len(args)))
+	}
+	if filter.ClientEmail != "" {
+		args = append(args, filter.ClientEmail)
+		conds = append(conds, fmt.Sprintf("client_email = $%d", len(args)))
+	}
+	if !filter.CreatedAfter.IsZero() {
+		args = append(args, s.t(filter.CreatedAfter))
+		conds = append(conds, fmt.Sprintf("created_at > $%d", len(args)))
+	}
+	if !filter.CreatedBefore.IsZero() {
+		args = append(args, s.t(filter.CreatedBefore))
+		conds = append(conds, fmt.Sprintf("created_at < $%d", len(args)))
+	}
+	if !filter.IncludeDeleted {
+		conds = append(conds, "deleted_at IS NULL")
+	}
+	for _, term := range filter.SearchTerms {
+		args = append(args, "%"+likeEscaper.Replace(term)+"%")
+		n := len(args)
+		conds = append(conds, fmt.Sprintf(
+			`(LOWER(gig_title) LIKE $%d ESCAPE '\' OR LOWER(client) LIKE $%d ESCAPE '\' OR LOWER(details) LIKE $%d ESCAPE '\')`,
+			n, n, n))
+	}
+
+	where := ""
+	if len(conds) > 0 {
+		where = ` WHERE ` + strings.Join(conds, " AND ")
+	}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, s.q(`SELECT COUNT(*) FROM requests`+where), args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	// Only whitelisted column names are ever interpolated into the query
+	sortBy := "id"
+	if filter.SortBy != "" && validSortField(filter.SortBy) {
+		sortBy = filter.SortBy
+	}
+	if sortBy == "gig_title" || sortBy == "client" {
+		sortBy += " " + s.dialect.byteOrder
+	}
+	direction := "ASC"
+	if filter.Descending {
+		direction = "DESC"
+	}
+
+	query := `SELECT ` + sqlRequestColumns + ` FROM requests` + where + ` ORDER BY ` + sortBy + ` ` + direction + `, id ` + direction
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	if filter.Offset > 0 {
+		if filter.Limit == 0 {
+			query += " LIMIT " + s.dialect.noLimit
+		}
+		args = append(args, filter.Offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+
+	rows, err := s.db.QueryContext(ctx, s.q(query), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	result := []Request{}
+	for rows.Next() {
+		req, err := scanRequest(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		result = append(result, req)
+	}
+
+	return result, total, rows.Err()
+}
+
+func (s *sqlStore) Get(ctx context.Context, id int) (Request, error) {
+	row := s.db.QueryRowContext(ctx, s.q(`SELECT `+sqlRequestColumns+` FROM requests WHERE id = $1`), id)
+
+	req, err := scanRequest(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Request{}, ErrNotFound
+	}
+	return req, err
+}
+
+func (s *sqlStore) Update(ctx context.Context, req Request) (Request, error) {
+	consent, err := consentValue(req.Consent)
+	if err != nil {
+		return Request{}, err
+	}
+
+	res, err := s.db.ExecContext(ctx, s.q(
+		`UPDATE requests SET gig_title = $1, client = $2, client_email = $3, supplier_email = $4,
+		 details = $5, status = $6, consent = $7, created_at = $8, deleted_at = $9 WHERE id = $10`),
+		req.GigTitle, req.Client, req.ClientEmail, req.SupplierEmail, req.Details, req.Status, consent, s.t(req.CreatedAt), s.tp(req.DeletedAt), req.ID,
+	)
+	if err != nil {
+		return Request{}, err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return Request{}, err
+	} else if n == 0 {
+		return Request{}, ErrNotFound
+	}
+
+	return req, nil
+}
+
+func (s *sqlStore) Delete(ctx context.Context, id int) error {
+	res, err := s.db.ExecContext(ctx, s.q(`DELETE FROM requests WHERE id = $1`), id)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Close releases the connection pool.
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"time"
+
+	_ "modernc.org/sqlite" // Registers the pure-Go "sqlite" database/sql driver
+)
+
+// sqliteTimeFormat is how timestamps are stored in SQLite.
+const sqliteTimeFormat = "2006-01-02 15:04:05.000000000-07:00"
+
+// sqlitePlaceholder matches the $N placeholders that sqlite needs as ?N.
+var sqlitePlaceholder = regexp.MustCompile(`\$(\d+)`)
+
+// sqliteDialect is the schema and SQL flavour of the SQLite backend.
+var sqliteDialect = sqlDialect{
+	name: "sqlite",
+	migrations: []string{
+		`CREATE TABLE requests (
+			id             INTEGER PRIMARY KEY AUTOINCREMENT,
+			gig_title      TEXT NOT NULL,
+			client         TEXT NOT NULL,
+			client_email   TEXT NOT NULL,
+			supplier_email TEXT NOT NULL,
+			details        TEXT NOT NULL DEFAULT '',
+			consent        TEXT,
+			created_at     TIMESTAMP NOT NULL
+		)`,
+		`CREATE INDEX requests_supplier_email_idx ON requests (supplier_email)`,
+		`ALTER TABLE requests ADD COLUMN deleted_at TIMESTAMP`,
+		`ALTER TABLE requests ADD COLUMN status TEXT NOT NULL DEFAULT 'pending'`,
+		`CREATE INDEX requests_status_idx ON requests (status)`,
+		`CREATE TABLE api_keys (
+			id             INTEGER PRIMARY KEY AUTOINCREMENT,
+			supplier_email TEXT NOT NULL,
+			prefix         TEXT NOT NULL,
+			key_hash       TEXT NOT NULL UNIQUE,
+			created_at     TIMESTAMP NOT NULL,
+			revoked_at     TIMESTAMP
+		)`,
+		`CREATE INDEX api_keys_supplier_email_idx ON api_keys (supplier_email)`,
+		`CREATE TABLE webhooks (
+			id             INTEGER PRIMARY KEY AUTOINCREMENT,
+			supplier_email TEXT NOT NULL,
+			url            TEXT NOT NULL,
+			events         TEXT NOT NULL,
+			secret         TEXT NOT NULL,
+			created_at     TIMESTAMP NOT NULL
+		)`,
+		`CREATE INDEX webhooks_supplier_email_idx ON webhooks (supplier_email)`,
+	},
+	noLimit: "-1",
+	migrationsTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`,
+	rebind: func(query string) string {
+		return sqlitePlaceholder.ReplaceAllString(query, "?$1")
+	},
+	// SQLite compares timestamps as text, so write them in UTC with a fixed
+	// number of fractional digits to keep lexical and chronological order equal
+	timeArg: func(t time.Time) any {
+		return t.UTC().Format(sqliteTimeFormat)
+	},
+	byteOrder: "COLLATE BINARY",
+}
+
+// newSQLiteStore opens (creating if needed) the database file at path and
+// brings the schema up to date.
+func newSQLiteStore(ctx context.Context, path string) (*sqlStore, error) {
+	dsn := "file:" + path + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)"
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("opening sqlite: %w", err)
+	}
+
+	// SQLite allows a single writer; one connection avoids "database is locked" errors
+	db.SetMaxOpenConns(1)
+
+	s := &sqlStore{db: db, dialect: sqliteDialect}
+	if err := s.migrate(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrating sqlite schema: %w", err)
+	}
+
+	return s, nil
+}
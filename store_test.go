@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// forEachStore runs test against a fresh store of each backend that needs no
+// outside service, so they are held to the same behaviour. Postgres needs a
+// server and isn't covered here.
+func forEachStore(t *testing.T, test func(t *testing.T, s Store)) {
+	t.Helper()
+
+	backends := []struct {
+		name string
+		open func(t *testing.T) Store
+	}{
+		{name: "memory", open: func(t *testing.T) Store { return newMemoryStore() }},
+		{name: "sqlite", open: func(t *testing.T) Store {
+			s, err := newSQLiteStore(context.Background(), filepath.Join(t.TempDir(), "requests.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { s.Close() })
+			return s
+		}},
+	}
+
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) { test(t, b.open(t)) })
+	}
+}
+
+// useStore makes s the store behind the handlers for the rest of the test.
+func useStore(t *testing.T, s Store) {
+	savedStore, savedWebhooks, savedDispatcher, savedNotifications := store, webhooks, dispatcher, notifications
+	t.Cleanup(func() {
+		store, webhooks, dispatcher, notifications = savedStore, savedWebhooks, savedDispatcher, savedNotifications
+	})
+	store, webhooks, dispatcher, notifications = s, newWebhookStore(s), newWebhookDispatcher(), newMailer()
+}
+
+// seedRequests creates reqs in order, filling in anything required that is
+// missing, and returns them as stored.
+func seedRequests(t *testing.T, s Store, reqs ...Request) []Request {
+	t.Helper()
+
+	created := make([]Request, len(reqs))
+	for i, req := range reqs {
+		if req.GigTitle == "" {
+			req.GigTitle = "Gig"
+		}
+		if req.Client == "" {
+			req.Client = "Client"
+		}
+		if req.ClientEmail == "" {
+			req.ClientEmail = "c@b.co"
+		}
+		if req.SupplierEmail == "" {
+			req.SupplierEmail = "s@b.co"
+		}
+		if req.Status == "" {
+			req.Status = StatusPending
+		}
+		if req.CreatedAt.IsZero() {
+			req.CreatedAt = time.Now()
+		}
+		var err error
+		if created[i], err = s.Create(context.Background(), req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return created
+}
+
+func TestStoreDeletedRequests(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		reqs := seedRequests(t, s, Request{}, Request{}, Request{})
+		deletedAt := time.Now()
+		reqs[1].DeletedAt = &deletedAt
+		if _, err := s.Update(ctx, reqs[1]); err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			name    string
+			filter  ListFilter
+			wantIDs []int
+		}{
+			{name: "hidden by default", filter: ListFilter{}, wantIDs: []int{reqs[0].ID, reqs[2].ID}},
+			{name: "included on request", filter: ListFilter{IncludeDeleted: true}, wantIDs: []int{reqs[0].ID, reqs[1].ID, reqs[2].ID}},
+			{name: "not counted in a page", filter: ListFilter{Limit: 1, Offset: 1}, wantIDs: []int{reqs[2].ID}},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				got, total, err := s.List(ctx, tt.filter)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if ids := requestIDs(got); !slices.Equal(ids, tt.wantIDs) {
+					t.Errorf("IDs %v, want %v", ids, tt.wantIDs)
+				}
+				wantTotal := 2
+				if tt.filter.IncludeDeleted {
+					wantTotal = 3
+				}
+				if total != wantTotal {
+					t.Errorf("total %d, want %d", total, wantTotal)
+				}
+			})
+		}
+
+		// Get still finds it, so admins can look deleted requests up; handlers hide it from everyone else
+		got, err := s.Get(ctx, reqs[1].ID)
+		if err != nil || got.DeletedAt == nil {
+			t.Errorf("Get deleted request = %+v, %v; want it with deleted_at set", got, err)
+		}
+	})
+}
+
+// requestIDs lists the IDs of reqs in order.
+func requestIDs(reqs []Request) []int {
+	ids := []int{}
+	for _, req := range reqs {
+		ids = append(ids, req.ID)
+	}
+	return ids
+}
+
+func TestStoreListOrdering(t *testing.T) {
+	base := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+
+	forEachStore(t, func(t *testing.T, s Store) {
+		// IDs 1-5; titles and clients differ only in case or accents so a
+		// collation that folds them would reorder the results
+		reqs := seedRequests(t, s,
+			Request{GigTitle: "banana", Client: "Émile", CreatedAt: base.Add(2 * time.Hour)},
+			Request{GigTitle: "Banana", Client: "emile", CreatedAt: base},
+			Request{GigTitle: "apple", Client: "Zed", CreatedAt: base.Add(time.Hour)},
+			Request{GigTitle: "Zebra", Client: "zed", CreatedAt: base.Add(time.Hour)},
+			Request{GigTitle: "éclair", Client: "Emile", CreatedAt: base.Add(3 * time.Hour)},
+		)
+		id := func(positions ...int) []int {
+			ids := make([]int, len(positions))
+			for i, p := range positions {
+				ids[i] = reqs[p].ID
+			}
+			return ids
+		}
+
+		tests := []struct {
+			sortBy     string
+			descending bool
+			want       []int
+		}{
+			{sortBy: "", want: id(0, 1, 2, 3, 4)},
+			{sortBy: "id", descending: true, want: id(4, 3, 2, 1, 0)},
+			{sortBy: "created_at", want: id(1, 2, 3, 0, 4)}, // Ties fall back to ID
+			{sortBy: "created_at", descending: true, want: id(4, 0, 3, 2, 1)},
+			{sortBy: "gig_title", want: id(1, 3, 2, 0, 4)}, // Byte order: upper case first, accents last
+			{sortBy: "gig_title", descending: true, want: id(4, 0, 2, 3, 1)},
+			{sortBy: "client", want: id(4, 2, 1, 3, 0)},
+			{sortBy: "client", descending: true, want: id(0, 3, 1, 2, 4)},
+		}
+
+		for _, tt := range tests {
+			name := tt.sortBy
+			if tt.descending {
+				name += " desc"
+			}
+			t.Run(name, func(t *testing.T) {
+				got, _, err := s.List(context.Background(), ListFilter{SortBy: tt.sortBy, Descending: tt.descending})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if ids := requestIDs(got); !slices.Equal(ids, tt.want) {
+					t.Errorf("IDs %v, want %v", ids, tt.want)
+				}
+
+				// Paging must cut the same order, not re-sort each page
+				var paged []Request
+				for offset := 0; offset < len(reqs); offset += 2 {
+					page, _, err := s.List(context.Background(), ListFilter{SortBy: tt.sortBy, Descending: tt.descending, Limit: 2, Offset: offset})
+					if err != nil {
+						t.Fatal(err)
+					}
+					paged = append(paged, page...)
+				}
+				if ids := requestIDs(paged); !slices.Equal(ids, tt.want) {
+					t.Errorf("paged IDs %v, want %v", ids, tt.want)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+)
+
+// Build information, injected at build time via ldflags, e.g.:
+//
+//	go build -ldflags "-X main.version=1.2.0 -X main.commit=$(git rev-parse --short HEAD) -X main.buildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildTime = "unknown"
+)
+
+// BuildInfo is the payload returned by GET /version.
+type BuildInfo struct {
+	Version   string   `json:"version"`
+	Commit    string   `json:"commit"`
+	BuildTime string   `json:"build_time"`
+	Features  []string `json:"features"`
+}
+
+// enabledFeatures lists the optional features switched on for this process.
+func enabledFeatures() []string {
+	features := []string{"storage_" + storageBackend}
+	if foldGmailAddresses {
+		features = append(features, "email_gmail_folding")
+	}
+	if os.Getenv("MTLS_PORT") != "" {
+		features = append(features, "mtls")
+	}
+	if partnerKeys != nil {
+		features = append(features, "partner_signatures")
+	}
+	if notifications.enabled() {
+		features = append(features, "email_"+notifications.provider)
+	}
+	if jwtEnabled() {
+		features = append(features, "jwt_auth")
+	}
+	if requireAPIKeys {
+		features = append(features, "require_api_keys")
+	}
+	if docsUIEnabled {
+		features = append(features, "docs_ui")
+	}
+	if requireConsent {
+		features = append(features, "require_consent")
+	}
+	return features
+}
+
+// VersionHandler handles GET /version, reporting which build is serving traffic.
+func VersionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	info := BuildInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildTime: buildTime,
+		Features:  enabledFeatures(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding response", "err", err)
+	}
+}
+
+// VersionHeaderHandler wraps the whole mux and stamps every response with X-App-Version.
+func VersionHeaderHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-App-Version", version+"+"+commit)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- Webhooks ---
+
+// Request lifecycle events a webhook can subscribe to.
+const (
+	EventRequestCreated = "request.created"
+	EventRequestUpdated = "request.updated"
+	EventRequestDeleted = "request.deleted"
+)
+
+// WebhookEvents lists every event, in the order they are documented.
+var WebhookEvents = []string{EventRequestCreated, EventRequestUpdated, EventRequestDeleted}
+
+// webhookSecretPrefix marks signing secrets, like apiKeyPrefix does for keys.
+const webhookSecretPrefix = "whsec_"
+
+// ErrWebhookNotFound is returned by a WebhookStore when no webhook matches.
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+// Webhook is a supplier's subscription to events on their requests. Deliveries
+// are signed with Secret, which is only shown when the webhook is created.
+type Webhook struct {
+	ID            int       `json:"id"`
+	SupplierEmail string    `json:"supplier_email"`
+	URL           string    `json:"url"`
+	Events        []string  `json:"events"`
+	Secret        string    `json:"-"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// subscribes reports whether the webhook wants the given event.
+func (h Webhook) subscribes(event string) bool {
+	for _, e := range h.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookStore persists webhooks. Each storage backend provides one alongside its Store.
+type WebhookStore interface {
+	// CreateWebhook saves a new webhook, assigning its ID.
+	CreateWebhook(ctx context.Context, hook Webhook) (Webhook, error)
+	// GetWebhook returns the webhook with the given ID, or ErrWebhookNotFound.
+	GetWebhook(ctx context.Context, id int) (Webhook, error)
+	// ListWebhooks returns a supplier's webhooks, or all webhooks if supplierEmail is empty.
+	ListWebhooks(ctx context.Context, supplierEmail string) ([]Webhook, error)
+	// UpdateWebhook replaces a webhook's URL and events, or returns ErrWebhookNotFound.
+	UpdateWebhook(ctx context.Context, hook Webhook) (Webhook, error)
+	// DeleteWebhook removes a webhook, or returns ErrWebhookNotFound.
+	DeleteWebhook(ctx context.Context, id int) error
+}
+
+// webhooks holds all webhooks. It is set up in main next to store.
+var webhooks WebhookStore
+
+// newWebhookStore returns the WebhookStore that shares a backend with the given Store.
+func newWebhookStore(s Store) WebhookStore {
+	if sqlS, ok := s.(*sqlStore); ok {
+		return &sqlWebhookStore{sqlS}
+	}
+	return newMemoryWebhookStore()
+}
+
+// generateWebhookSecret returns a new random signing secret.
+func generateWebhookSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return webhookSecretPrefix + hex.EncodeToString(b), nil
+}
+
+// webhookInput is the body of POST /webhooks and PUT /webhooks/{id}.
+type webhookInput struct {
+	SupplierEmail string   `json:"supplier_email"`
+	URL           string   `json:"url"`
+	Events        []string `json:"events"`
+}
+
+// webhookCreated is the response to POST /webhooks, the only time the secret is shown.
+type webhookCreated struct {
+	Secret  string  `json:"secret"`
+	Webhook Webhook `json:"webhook"`
+}
+
+// validateWebhook checks a webhook's URL and events, defaulting to every event.
+// On failure it writes a 400 listing the invalid fields and returns false.
+func validateWebhook(w http.ResponseWriter, r *http.Request, hook *Webhook) bool {
+	problems := map[string]string{}
+
+	hook.URL = strings.TrimSpace(hook.URL)
+	if problem := checkWebhookURL(hook.URL); problem != "" {
+		problems["url"] = problem
+	}
+
+	if len(hook.Events) == 0 {
+		hook.Events = append([]string(nil), WebhookEvents...)
+	}
+	for _, event := range hook.Events {
+		if !validWebhookEvent(event) {
+			problems["events"] = "must be one of " + strings.Join(WebhookEvents, ", ")
+			break
+		}
+	}
+
+	if hook.SupplierEmail == "" {
+		problems["supplier_email"] = "required"
+	}
+
+	if len(problems) > 0 {
+		writeAPIError(w, r, http.StatusBadRequest, APIError{
+			Code:    codeValidationFailed,
+			Message: "Invalid webhook: see details for each field",
+			Details: problems,
+		})
+		return false
+	}
+	return true
+}
+
+// validWebhookEvent reports whether event is one of WebhookEvents.
+func validWebhookEvent(event string) bool {
+	for _, e := range WebhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// checkWebhookURL returns what is wrong with a webhook URL, or "" if it is usable.
+// The outbound policy is checked here too, so blocked destinations fail at
+// registration instead of on every delivery.
+func checkWebhookURL(raw string) string {
+	if raw == "" {
+		return "required"
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Hostname() == "" {
+		return "must be an absolute http or https URL"
+	}
+
+	if err := webhookOutbound.checkHost(u.Hostname()); err != nil {
+		return "destination not allowed"
+	}
+	if err := webhookOutbound.checkDestination(hostPort(u)); err != nil {
+		return "destination not allowed"
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil {
+		if err := webhookOutbound.checkIP(ip); err != nil {
+			return "destination not allowed"
+		}
+	}
+	return ""
+}
+
+// WebhooksHandler handles GET (list) and POST (register) on /webhooks.
+func WebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		listWebhooks(w, r)
+	case "POST":
+		createWebhook(w, r)
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// WebhookHandler handles GET, PUT and DELETE on /webhooks/{id}.
+func WebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/webhooks/"))
+	if err != nil || id <= 0 {
+		writeError(w, r, http.StatusNotFound, "Webhook not found")
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		if hook, ok := loadWebhook(w, r, id); ok {
+			writeWebhookJSON(w, r, http.StatusOK, hook)
+		}
+	case "PUT":
+		replaceWebhook(w, r, id)
+	case "DELETE":
+		deleteWebhook(w, r, id)
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// listWebhooks returns the caller's webhooks; admins may filter by supplier_email.
+func listWebhooks(w http.ResponseWriter, r *http.Request) {
+	supplierEmail := normalizeEmail(r.URL.Query().Get("supplier_email"))
+
+	switch caller := callerFromContext(r.Context()); caller.Role {
+	case RoleSupplier:
+		if supplierEmail != "" && supplierEmail != caller.Email {
+			writeError(w, r, http.StatusForbidden, "Forbidden: credentials are scoped to "+caller.scope())
+			return
+		}
+		supplierEmail = caller.Email
+	case RoleClient:
+		writeError(w, r, http.StatusForbidden, "Forbidden: only suppliers can manage webhooks")
+		return
+	}
+
+	list, err := webhooks.ListWebhooks(r.Context(), supplierEmail)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error listing webhooks", "err", err)
+		writeError(w, r, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(list); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding response", "err", err)
+	}
+}
+
+// createWebhook registers a webhook. The signing secret is only returned here.
+func createWebhook(w http.ResponseWriter, r *http.Request) {
+	var body webhookInput
+	if !decodeJSONBody(w, r, &body) {
+		return
+	}
+
+	// A supplier registers webhooks for themselves unless told otherwise
+	caller := callerFromContext(r.Context())
+	hook := Webhook{
+		SupplierEmail: normalizeEmail(body.SupplierEmail),
+		URL:           body.URL,
+		Events:        body.Events,
+		CreatedAt:     time.Now(),
+	}
+	if caller.Role == RoleSupplier && hook.SupplierEmail == "" {
+		hook.SupplierEmail = caller.Email
+	}
+
+	if !validateWebhook(w, r, &hook) {
+		return
+	}
+	if !caller.canAccessSupplier(hook.SupplierEmail) {
+		writeError(w, r, http.StatusForbidden, "Forbidden: credentials are scoped to "+caller.scope())
+		return
+	}
+
+	secret, err := generateWebhookSecret()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error generating webhook secret", "err", err)
+		writeError(w, r, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+	hook.Secret = secret
+
+	hook, err = webhooks.CreateWebhook(r.Context(), hook)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error creating webhook", "err", err)
+		writeError(w, r, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Webhook registered", "webhook_id", hook.ID, "supplier", hook.SupplierEmail, "events", hook.Events)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	resp := webhookCreated{Secret: secret, Webhook: hook}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding response", "err", err)
+	}
+}
+
+// replaceWebhook handles PUT /webhooks/{id}, replacing the URL and events.
+// The owning supplier and the secret never change.
+func replaceWebhook(w http.ResponseWriter, r *http.Request, id int) {
+	hook, ok := loadWebhook(w, r, id)
+	if !ok {
+		return
+	}
+
+	var body webhookInput
+	if !decodeJSONBody(w, r, &body) {
+		return
+	}
+	hook.URL = body.URL
+	hook.Events = body.Events
+
+	if !validateWebhook(w, r, &hook) {
+		return
+	}
+
+	hook, err := webhooks.UpdateWebhook(r.Context(), hook)
+	if errors.Is(err, ErrWebhookNotFound) {
+		writeError(w, r, http.StatusNotFound, "Webhook not found")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error updating webhook", "webhook_id", id, "err", err)
+		writeError(w, r, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Webhook updated", "webhook_id", id)
+	writeWebhookJSON(w, r, http.StatusOK, hook)
+}
+
+// deleteWebhook handles DELETE /webhooks/{id}. Deliveries already queued still go out.
+func deleteWebhook(w http.ResponseWriter, r *http.Request, id int) {
+	if _, ok := loadWebhook(w, r, id); !ok {
+		return
+	}
+
+	err := webhooks.DeleteWebhook(r.Context(), id)
+	if errors.Is(err, ErrWebhookNotFound) {
+		writeError(w, r, http.StatusNotFound, "Webhook not found")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error deleting webhook", "webhook_id", id, "err", err)
+		writeError(w, r, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Webhook deleted", "webhook_id", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loadWebhook fetches a webhook the caller may manage, writing a 404 (also for
+// other suppliers' webhooks) or 500 and returning false otherwise.
+func loadWebhook(w http.ResponseWriter, r *http.Request, id int) (Webhook, bool) {
+	hook, err := webhooks.GetWebhook(r.Context(), id)
+	if errors.Is(err, ErrWebhookNotFound) || (err == nil && !callerFromContext(r.Context()).canAccessSupplier(hook.SupplierEmail)) {
+		writeError(w, r, http.StatusNotFound, "Webhook not found")
+		return Webhook{}, false
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error fetching webhook", "webhook_id", id, "err", err)
+		writeError(w, r, http.StatusInternalServerError, "Internal Server Error")
+		return Webhook{}, false
+	}
+	return hook, true
+}
+
+// writeWebhookJSON writes a single webhook (without its secret).
+func writeWebhookJSON(w http.ResponseWriter, r *http.Request, status int, hook Webhook) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(hook); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding response", "err", err)
+	}
+}
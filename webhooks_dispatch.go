@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// --- Webhook Delivery ---
+
+// Deliveries are POSTed as JSON with these headers:
+//
+//	Webhook-Id          unique per delivery; retries reuse it, so receivers can dedupe
+//	Webhook-Event       e.g. "request.created"
+//	Webhook-Signature   "t=<unix seconds>,v1=<hex HMAC-SHA256(secret, t + "." + body)>"
+//
+// Failed deliveries (network errors, 5xx, 408 and 429) are retried with
+// exponential backoff. Pending retries live in memory and are lost on restart.
+//
+//	WEBHOOK_MAX_ATTEMPTS   attempts per delivery, including the first (default 6)
+//	WEBHOOK_CONCURRENCY    deliveries sent at once (default 4)
+
+const (
+	webhookBaseBackoff = 2 * time.Second
+	webhookMaxBackoff  = 10 * time.Minute
+	webhookMaxPending  = 10000 // Deliveries waiting to be sent or retried
+)
+
+// WebhookPayload is the body of every delivery.
+type WebhookPayload struct {
+	ID        string    `json:"id"`
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      Request   `json:"data"`
+}
+
+// webhookDispatcher sends deliveries in the background.
+type webhookDispatcher struct {
+	client      *http.Client
+	maxAttempts int
+	slots       chan struct{} // Bounds concurrent sends
+	pending     atomic.Int64
+	stop        chan struct{}
+	wg          sync.WaitGroup
+}
+
+// dispatcher delivers webhook events. It is set up in main.
+var dispatcher *webhookDispatcher
+
+// newWebhookDispatcher reads its settings from the environment.
+func newWebhookDispatcher() *webhookDispatcher {
+	return &webhookDispatcher{
+		client:      newOutboundClient(webhookOutbound, 10*time.Second),
+		maxAttempts: envInt("WEBHOOK_MAX_ATTEMPTS", 6),
+		slots:       make(chan struct{}, envInt("WEBHOOK_CONCURRENCY", 4)),
+		stop:        make(chan struct{}),
+	}
+}
+
+// Publish queues an event for every webhook of the request's supplier that
+// subscribes to it. It never blocks on delivery; failures are only logged.
+func (d *webhookDispatcher) Publish(ctx context.Context, event string, req Request) {
+	hooks, err := webhooks.ListWebhooks(ctx, req.SupplierEmail)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error listing webhooks for event", "event", event, "err", err)
+		return
+	}
+
+	for _, hook := range hooks {
+		if !hook.subscribes(event) {
+			continue
+		}
+
+		payload := WebhookPayload{ID: "evt_" + newRequestID(), Event: event, CreatedAt: time.Now(), Data: req}
+		body, err := json.Marshal(payload)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error encoding webhook payload", "event", event, "err", err)
+			return
+		}
+
+		if d.pending.Add(1) > webhookMaxPending {
+			d.pending.Add(-1)
+			slog.ErrorContext(ctx, "Webhook queue full; dropping delivery", "webhook_id", hook.ID, "event", event)
+			continue
+		}
+
+		d.wg.Add(1)
+		go d.deliver(hook, payload.ID, event, body)
+	}
+}
+
+// deliver sends one payload, retrying with backoff until it succeeds, fails
+// permanently, runs out of attempts or the dispatcher stops.
+func (d *webhookDispatcher) deliver(hook Webhook, id, event string, body []byte) {
+	defer d.wg.Done()
+	defer d.pending.Add(-1)
+
+	log := slog.With("webhook_id", hook.ID, "delivery_id", id, "event", event)
+
+	for attempt := 1; ; attempt++ {
+		select {
+		case d.slots <- struct{}{}:
+		case <-d.stop:
+			log.Warn("Webhook delivery abandoned at shutdown", "attempt", attempt)
+			return
+		}
+		retry, err := d.send(hook, id, event, body)
+		<-d.slots
+
+		if err == nil {
+			log.Info("Webhook delivered", "attempt", attempt)
+			return
+		}
+		if !retry || attempt >= d.maxAttempts {
+			log.Error("Webhook delivery failed", "attempt", attempt, "err", err)
+			return
+		}
+
+		wait := webhookBackoff(attempt)
+		log.Warn("Webhook delivery failed; retrying", "attempt", attempt, "retry_in", wait.String(), "err", err)
+
+		select {
+		case <-time.After(wait):
+		case <-d.stop:
+			log.Warn("Webhook delivery abandoned at shutdown", "attempt", attempt)
+			return
+		}
+	}
+}
+
+// webhookBackoff is the wait before retry n: doubling from webhookBaseBackoff,
+// capped at webhookMaxBackoff, with up to 20% jitter so retries don't align.
+func webhookBackoff(attempt int) time.Duration {
+	wait := webhookBaseBackoff << (attempt - 1)
+	if wait <= 0 || wait > webhookMaxBackoff {
+		wait = webhookMaxBackoff
+	}
+	return wait - time.Duration(rand.Int63n(int64(wait)/5+1))
+}
+
+// errWebhookStatus is a non-2xx response from a webhook receiver.
+var errWebhookStatus = errors.New("webhook receiver returned an error status")
+
+// send POSTs one signed delivery and reports whether a failure is worth retrying.
+func (d *webhookDispatcher) send(hook Webhook, id, event string, body []byte) (retry bool, err error) {
+	req, err := http.NewRequest("POST", hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "api-go-webhooks/"+version)
+	req.Header.Set("Webhook-Id", id)
+	req.Header.Set("Webhook-Event", event)
+	req.Header.Set("Webhook-Signature", "t="+timestamp+",v1="+signWebhook(hook.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		// The policy won't change between attempts
+		return !errors.Is(err, ErrDestinationBlocked), err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests:
+		return true, fmt.Errorf("%w: %d", errWebhookStatus, resp.StatusCode)
+	default:
+		return false, fmt.Errorf("%w: %d", errWebhookStatus, resp.StatusCode)
+	}
+}
+
+// signWebhook returns the hex HMAC-SHA256 of "timestamp.body" under secret.
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Shutdown abandons pending retries and waits for sends in progress, up to ctx's deadline.
+func (d *webhookDispatcher) Shutdown(ctx context.Context) error {
+	close(d.stop)
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// memoryWebhookStore keeps webhooks in a slice, next to the in-memory Store.
+type memoryWebhookStore struct {
+	mu     sync.Mutex
+	hooks  []Webhook
+	nextID int
+}
+
+// newMemoryWebhookStore returns an empty in-memory webhook store.
+func newMemoryWebhookStore() *memoryWebhookStore {
+	return &memoryWebhookStore{nextID: 1}
+}
+
+func (s *memoryWebhookStore) CreateWebhook(ctx context.Context, hook Webhook) (Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hook.ID = s.nextID
+	s.nextID++
+	s.hooks = append(s.hooks, hook)
+
+	return hook, nil
+}
+
+func (s *memoryWebhookStore) GetWebhook(ctx context.Context, id int) (Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, hook := range s.hooks {
+		if hook.ID == id {
+			return hook, nil
+		}
+	}
+	return Webhook{}, ErrWebhookNotFound
+}
+
+func (s *memoryWebhookStore) ListWebhooks(ctx context.Context, supplierEmail string) ([]Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := []Webhook{}
+	for _, hook := range s.hooks {
+		if supplierEmail == "" || hook.SupplierEmail == supplierEmail {
+			result = append(result, hook)
+		}
+	}
+	return result, nil
+}
+
+func (s *memoryWebhookStore) UpdateWebhook(ctx context.Context, hook Webhook) (Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.hooks {
+		if s.hooks[i].ID == hook.ID {
+			s.hooks[i].URL = hook.URL
+			s.hooks[i].Events = hook.Events
+			return s.hooks[i], nil
+		}
+	}
+	return Webhook{}, ErrWebhookNotFound
+}
+
+func (s *memoryWebhookStore) DeleteWebhook(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.hooks {
+		if s.hooks[i].ID == id {
+			s.hooks = append(s.hooks[:i], s.hooks[i+1:]...)
+			return nil
+		}
+	}
+	return ErrWebhookNotFound
+}
+
+// sqlWebhookStore keeps webhooks in the webhooks table of a SQL backend.
+// Events are stored comma separated; event names never contain commas.
+type sqlWebhookStore struct {
+	*sqlStore
+}
+
+const sqlWebhookColumns = `id, supplier_email, url, events, secret, created_at`
+
+// scanWebhook reads one row selected with sqlWebhookColumns.
+func scanWebhook(row rowScanner) (Webhook, error) {
+	var hook Webhook
+	var events string
+
+	if err := row.Scan(&hook.ID, &hook.SupplierEmail, &hook.URL, &events, &hook.Secret, &hook.CreatedAt); err != nil {
+		return Webhook{}, err
+	}
+	hook.Events = strings.Split(events, ",")
+	return hook, nil
+}
+
+func (s *sqlWebhookStore) CreateWebhook(ctx context.Context, hook Webhook) (Webhook, error) {
+	err := s.db.QueryRowContext(ctx, s.q(
+		`INSERT INTO webhooks (supplier_email, url, events, secret, created_at) VALUES ($1, $2, $3, $4, $5) RETURNING id`),
+		hook.SupplierEmail, hook.URL, strings.Join(hook.Events, ","), hook.Secret, s.t(hook.CreatedAt),
+	).Scan(&hook.ID)
+	if err != nil {
+		return Webhook{}, err
+	}
+	return hook, nil
+}
+
+func (s *sqlWebhookStore) GetWebhook(ctx context.Context, id int) (Webhook, error) {
+	row := s.db.QueryRowContext(ctx, s.q(`SELECT `+sqlWebhookColumns+` FROM webhooks WHERE id = $1`), id)
+
+	hook, err := scanWebhook(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Webhook{}, ErrWebhookNotFound
+	}
+	return hook, err
+}
+
+func (s *sqlWebhookStore) ListWebhooks(ctx context.Context, supplierEmail string) ([]Webhook, error) {
+	query := `SELECT ` + sqlWebhookColumns + ` FROM webhooks`
+	var args []any
+	if supplierEmail != "" {
+		query += ` WHERE supplier_email = $1`
+		args = append(args, supplierEmail)
+	}
+	query += ` ORDER BY id`
+
+	rows, err := s.db.QueryContext(ctx, s.q(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []Webhook{}
+	for rows.Next() {
+		hook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, hook)
+	}
+	return result, rows.Err()
+}
+
+func (s *sqlWebhookStore) UpdateWebhook(ctx context.Context, hook Webhook) (Webhook, error) {
+	row := s.db.QueryRowContext(ctx, s.q(
+		`UPDATE webhooks SET url = $1, events = $2 WHERE id = $3 RETURNING `+sqlWebhookColumns),
+		hook.URL, strings.Join(hook.Events, ","), hook.ID,
+	)
+
+	hook, err := scanWebhook(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Webhook{}, ErrWebhookNotFound
+	}
+	return hook, err
+}
+
+func (s *sqlWebhookStore) DeleteWebhook(ctx context.Context, id int) error {
+	res, err := s.db.ExecContext(ctx, s.q(`DELETE FROM webhooks WHERE id = $1`), id)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// --- WebSocket Notifications ---
+
+// Suppliers connect to /ws (authenticated like any other route; browsers may pass
+// ?access_token= instead of a header) and get a JSON message for every create,
+// update and delete on their requests:
+//
+//	{"type": "request.created", "data": {...request...}}
+//
+// A connection starts subscribed to the caller's own supplier_email (or the
+// ?supplier_email= one, for admins) and can add more with
+//
+//	{"type": "subscribe", "supplier_email": "..."}
+//
+// Clients have no supplier feed and connect without one; they, like suppliers,
+// use the per-request presence and typing messages in ws_presence.go. Dropped
+// connections can pick up where they left off; see ws_resume.go.
+
+const (
+	wsWriteTimeout  = 10 * time.Second
+	wsPongTimeout   = 60 * time.Second
+	wsPingInterval  = wsPongTimeout * 9 / 10
+	wsMaxMessage    = 4 << 10
+	wsSendQueueSize = 64 // Messages buffered per connection before it counts as stuck
+)
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// Browsers always send Origin; apply the same allowlist as CORS
+	CheckOrigin: func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		return origin == "" || cors.allowOrigin(origin) != ""
+	},
+}
+
+// wsMessage is every message sent or received on /ws.
+type wsMessage struct {
+	Type          string   `json:"type"`
+	SupplierEmail string   `json:"supplier_email,omitempty"`
+	Data          *Request `json:"data,omitempty"`
+	Error         string   `json:"error,omitempty"`
+
+	// Presence and typing fields
+	RequestID int      `json:"request_id,omitempty"`
+	Status    string   `json:"status,omitempty"`
+	Typing    *bool    `json:"typing,omitempty"`
+	From      *wsPeer  `json:"from,omitempty"`
+	Members   []wsPeer `json:"members,omitempty"`
+
+	// Resume fields
+	Seq         int64  `json:"seq,omitempty"`
+	ResumeToken string `json:"resume_token,omitempty"`
+	Resumed     bool   `json:"resumed,omitempty"`
+	Overflowed  bool   `json:"overflowed,omitempty"`
+}
+
+// wsClient is one connection. Writes go through send so only writePump touches the socket.
+type wsClient struct {
+	conn   *websocket.Conn
+	caller Caller
+	send   chan []byte
+	// session is set once by hub.connect; threads and lastTyping are guarded by hub.mu.
+	session    *wsSession
+	threads    map[int]bool
+	lastTyping map[int]time.Time
+}
+
+// wsHub tracks sessions by the supplier emails they subscribe to, and
+// connections by the request threads they have joined.
+type wsHub struct {
+	mu        sync.Mutex
+	clients   map[*wsClient]bool
+	sessions  map[string]*wsSession // By resume token
+	subs      map[string]map[*wsSession]bool
+	threads   map[int]map[*wsClient]bool
+	seq       int64 // Last sequence number given to a request event
+	lastSweep time.Time
+}
+
+// hub fans request events out to WebSocket subscribers.
+var hub = &wsHub{
+	clients:  map[*wsClient]bool{},
+	sessions: map[string]*wsSession{},
+	subs:     map[string]map[*wsSession]bool{},
+	threads:  map[int]map[*wsClient]bool{},
+}
+
+func (h *wsHub) subscribe(s *wsSession, supplierEmail string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.subs[supplierEmail] == nil {
+		h.subs[supplierEmail] = map[*wsSession]bool{}
+	}
+	h.subs[supplierEmail][s] = true
+	s.subscriptions[supplierEmail] = true
+}
+
+// remove forgets a closed connection. Its session stays subscribed, buffering
+// events, until it is resumed or expires.
+func (h *wsHub) remove(c *wsClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// Leaving every thread tells the others this connection went offline
+	for id := range c.threads {
+		h.leaveLocked(c, id)
+	}
+	delete(h.clients, c)
+
+	// A resume from a new connection may already have taken the session over
+	if c.session.client == c {
+		c.session.client = nil
+		c.session.detachedAt = time.Now()
+	}
+}
+
+// Publish sends an event to every session subscribed to the request's supplier,
+// recording it for resumes. A connection whose queue is full is dropped rather
+// than slowing everyone down; it can resume and catch up.
+func (h *wsHub) Publish(event string, req Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.sweepLocked(time.Now())
+
+	h.seq++
+	msg, err := json.Marshal(wsMessage{Type: event, Data: &req, Seq: h.seq})
+	if err != nil {
+		slog.Error("Error encoding WebSocket message", "event", event, "err", err)
+		return
+	}
+
+	for s := range h.subs[req.SupplierEmail] {
+		s.record(h.seq, msg)
+		if s.client == nil {
+			continue
+		}
+		select {
+		case s.client.send <- msg:
+		default:
+			slog.Warn("WebSocket client too slow; disconnecting", "supplier", req.SupplierEmail)
+			s.client.conn.Close()
+		}
+	}
+}
+
+// Shutdown tells every connection the server is going away. http.Server.Shutdown
+// doesn't track hijacked connections, so main registers this with RegisterOnShutdown.
+func (h *wsHub) Shutdown() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	for c := range h.clients {
+		// WriteControl is safe alongside writePump's writes
+		c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+		c.conn.Close()
+	}
+}
+
+// WSHandler upgrades GET /ws to a WebSocket for real-time request events.
+func WSHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	caller := callerFromContext(r.Context())
+	supplierEmail := normalizeEmail(r.URL.Query().Get("supplier_email"))
+	if supplierEmail == "" && caller.Role == RoleSupplier {
+		supplierEmail = caller.Email
+	}
+	if supplierEmail == "" && caller.Role != RoleClient {
+		writeAPIError(w, r, http.StatusBadRequest, APIError{
+			Code:    codeInvalidParameter,
+			Message: "Missing 'supplier_email' parameter",
+			Details: map[string]string{"supplier_email": "required"},
+		})
+		return
+	}
+	if supplierEmail != "" && !caller.canAccessSupplier(supplierEmail) {
+		writeError(w, r, http.StatusForbidden, "Forbidden: credentials are scoped to "+caller.scope())
+		return
+	}
+
+	resumeToken := r.URL.Query().Get("resume_token")
+	var lastSeq int64
+	if v := r.URL.Query().Get("last_seq"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			invalidParam(w, r, "last_seq", "must be a non-negative integer")
+			return
+		}
+		lastSeq = n
+	}
+	newToken, err := newResumeToken()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error generating resume token", "err", err)
+		writeError(w, r, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	// Upgrade writes its own error response on failure
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.InfoContext(r.Context(), "WebSocket upgrade failed", "err", err)
+		return
+	}
+
+	c := &wsClient{
+		conn:       conn,
+		caller:     caller,
+		send:       make(chan []byte, wsSendQueueSize),
+		threads:    map[int]bool{},
+		lastTyping: map[int]time.Time{},
+	}
+	resumed := hub.connect(c, resumeToken, lastSeq, newToken)
+	if supplierEmail != "" {
+		hub.subscribe(c.session, supplierEmail)
+	}
+	slog.InfoContext(r.Context(), "WebSocket connected", "supplier", supplierEmail, "role", caller.Role, "resumed", resumed)
+
+	go c.writePump()
+	c.readPump(r.Context())
+}
+
+// readPump handles incoming messages and pongs until the connection fails.
+// It owns cleanup: leaving the hub and closing send stops writePump.
+func (c *wsClient) readPump(ctx context.Context) {
+	defer func() {
+		hub.remove(c)
+		close(c.send)
+		c.conn.Close()
+	}()
+
+	c.conn.SetReadLimit(wsMaxMessage)
+	c.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+
+	for {
+		var msg wsMessage
+		if err := c.conn.ReadJSON(&msg); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				slog.Info("WebSocket closed", "err", err)
+			}
+			return
+		}
+
+		switch msg.Type {
+		case "subscribe":
+			email := normalizeEmail(msg.SupplierEmail)
+			if email == "" || !c.caller.canAccessSupplier(email) {
+				c.reply(wsMessage{Type: "error", Error: "cannot subscribe to " + msg.SupplierEmail})
+				continue
+			}
+			hub.subscribe(c.session, email)
+			c.reply(wsMessage{Type: "subscribed", SupplierEmail: email})
+		case "join":
+			c.join(ctx, msg.RequestID)
+		case "leave":
+			hub.leave(c, msg.RequestID)
+		case "typing":
+			c.typing(msg.RequestID, msg.Typing != nil && *msg.Typing)
+		default:
+			c.reply(wsMessage{Type: "error", Error: "unknown message type " + msg.Type})
+		}
+	}
+}
+
+// reply queues a message for this connection only.
+func (c *wsClient) reply(msg wsMessage) {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	select {
+	case c.send <- b:
+	default:
+	}
+}
+
+// writePump writes queued messages and keepalive pings until send is closed.
+func (c *wsClient) writePump() {
+	ticker := time.NewTicker(wsPingInterval)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case msg, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if !ok {
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// --- WebSocket Presence and Typing ---
+
+// Each request has a thread that the supplier and client negotiating it can
+// join over /ws, to see who else is looking at it and who is typing:
+//
+//	{"type": "join", "request_id": 42}
+//	{"type": "typing", "request_id": 42, "typing": true}
+//	{"type": "leave", "request_id": 42}
+//
+// Joining replies {"type": "joined", "request_id": 42, "members": [...]} and tells
+// the rest of the thread {"type": "presence", "status": "online", "from": {...}}.
+// Leaving or disconnecting sends "offline". Typing is relayed to the others as
+// {"type": "typing", "typing": true, "from": {...}}.
+//
+// None of this is stored: a restart or dropped connection simply ends presence.
+// Clients should repeat typing=true every few seconds while the user types and
+// treat it as lapsed after about three times wsTypingThrottle without a repeat.
+
+const (
+	wsMaxThreads     = 50 // Threads one connection may join at once
+	wsTypingThrottle = 2 * time.Second
+)
+
+// wsPeer identifies a thread member to the others.
+type wsPeer struct {
+	Role  string `json:"role"`
+	Email string `json:"email,omitempty"`
+	Name  string `json:"name,omitempty"`
+}
+
+func peerOf(caller Caller) wsPeer {
+	return wsPeer{Role: caller.Role, Email: caller.Email, Name: caller.Name}
+}
+
+// join adds the connection to a request's thread, if the caller may see the request.
+func (c *wsClient) join(ctx context.Context, id int) {
+	fail := func(problem string) {
+		c.reply(wsMessage{Type: "error", RequestID: id, Error: "cannot join request " + strconv.Itoa(id) + ": " + problem})
+	}
+
+	if id <= 0 {
+		fail("invalid request_id")
+		return
+	}
+
+	req, err := store.Get(ctx, id)
+	if errors.Is(err, ErrNotFound) || (err == nil && (req.DeletedAt != nil || !c.caller.canAccess(req))) {
+		// Same answer for missing and forbidden, as on GET /requests/{id}
+		fail("not found")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Error loading request for WebSocket join", "id", id, "err", err)
+		fail("internal error")
+		return
+	}
+
+	members, ok := hub.join(c, id)
+	if !ok {
+		fail("too many threads joined")
+		return
+	}
+	c.reply(wsMessage{Type: "joined", RequestID: id, Members: members})
+}
+
+// join adds c to the thread and announces it, returning the members already
+// there. It fails once c is in wsMaxThreads threads.
+func (h *wsHub) join(c *wsClient, id int) ([]wsPeer, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !c.threads[id] && len(c.threads) >= wsMaxThreads {
+		return nil, false
+	}
+
+	members := []wsPeer{}
+	for other := range h.threads[id] {
+		if other != c {
+			members = append(members, peerOf(other.caller))
+		}
+	}
+
+	if !c.threads[id] {
+		if h.threads[id] == nil {
+			h.threads[id] = map[*wsClient]bool{}
+		}
+		h.threads[id][c] = true
+		c.threads[id] = true
+
+		from := peerOf(c.caller)
+		h.broadcastLocked(id, c, wsMessage{Type: "presence", RequestID: id, Status: "online", From: &from})
+	}
+
+	return members, true
+}
+
+// leave removes c from the thread, telling the others it went offline.
+func (h *wsHub) leave(c *wsClient, id int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.leaveLocked(c, id)
+}
+
+// leaveLocked is leave for callers already holding h.mu.
+func (h *wsHub) leaveLocked(c *wsClient, id int) {
+	if !c.threads[id] {
+		return
+	}
+
+	delete(c.threads, id)
+	delete(c.lastTyping, id)
+	delete(h.threads[id], c)
+	if len(h.threads[id]) == 0 {
+		delete(h.threads, id)
+		return
+	}
+
+	from := peerOf(c.caller)
+	h.broadcastLocked(id, c, wsMessage{Type: "presence", RequestID: id, Status: "offline", From: &from})
+}
+
+// typing relays a typing indicator to the rest of the thread. Repeats of
+// typing=true within wsTypingThrottle are dropped; typing=false always goes out.
+func (c *wsClient) typing(id int, typing bool) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	if !c.threads[id] {
+		c.reply(wsMessage{Type: "error", RequestID: id, Error: "join request " + strconv.Itoa(id) + " before sending typing"})
+		return
+	}
+
+	now := time.Now()
+	if typing {
+		if now.Sub(c.lastTyping[id]) < wsTypingThrottle {
+			return
+		}
+		c.lastTyping[id] = now
+	} else {
+		delete(c.lastTyping, id)
+	}
+
+	from := peerOf(c.caller)
+	hub.broadcastLocked(id, c, wsMessage{Type: "typing", RequestID: id, Typing: &typing, From: &from})
+}
+
+// broadcastLocked sends msg to every member of the thread except the sender.
+// These events are ephemeral, so a full queue just misses one rather than
+// costing the connection. Callers must hold h.mu.
+func (h *wsHub) broadcastLocked(id int, except *wsClient, msg wsMessage) {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		slog.Error("Error encoding WebSocket message", "type", msg.Type, "err", err)
+		return
+	}
+
+	for c := range h.threads[id] {
+		if c == except {
+			continue
+		}
+		select {
+		case c.send <- b:
+		default:
+		}
+	}
+}
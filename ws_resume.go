@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// --- WebSocket Resume ---
+
+// Every connection belongs to a session, announced in its first message:
+//
+//	{"type": "session", "resume_token": "...", "seq": 120}
+//
+// Request events carry an increasing "seq". A client that loses its connection
+// reconnects within wsResumeWindow with ?resume_token=...&last_seq=<last seq it
+// saw> and gets its subscriptions back plus every event it missed, replayed in
+// order after {"type": "session", "resumed": true, ...}. Only the last
+// wsResumeBuffer events are kept; if some it missed are gone, the session
+// message says "overflowed": true instead of replaying, and the client should
+// refetch. An unknown or expired token gets a fresh session ("resumed" absent).
+//
+// Sessions live in memory, so a restart or another instance behind the load
+// balancer also means a fresh session. Presence in request threads is not
+// resumed; rejoin them after reconnecting.
+
+const (
+	wsResumeWindow = 2 * time.Minute
+	// A replay must fit in the send queue with room left for live events.
+	wsResumeBuffer = wsSendQueueSize - 16
+)
+
+// wsBufferedEvent is an encoded request event kept for replay.
+type wsBufferedEvent struct {
+	seq int64
+	msg []byte
+}
+
+// wsSession is a connection's subscriptions and recent events, kept for
+// wsResumeWindow after it disconnects. Guarded by hub.mu.
+type wsSession struct {
+	token         string
+	caller        Caller
+	subscriptions map[string]bool
+	events        []wsBufferedEvent // The last wsResumeBuffer events, oldest first
+	evictedSeq    int64             // Highest seq dropped from events
+	client        *wsClient         // nil while disconnected
+	detachedAt    time.Time
+}
+
+// newResumeToken returns a new random session token.
+func newResumeToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// record keeps an event for replay, dropping the oldest once the buffer is full.
+func (s *wsSession) record(seq int64, msg []byte) {
+	if len(s.events) == wsResumeBuffer {
+		s.evictedSeq = s.events[0].seq
+		s.events = append(s.events[:0], s.events[1:]...)
+	}
+	s.events = append(s.events, wsBufferedEvent{seq: seq, msg: msg})
+}
+
+// connect registers c, resuming the session named by token when the same
+// caller owns it, or starting one with newToken otherwise. It queues the
+// session message and any replay, and reports whether it resumed.
+func (h *wsHub) connect(c *wsClient, token string, lastSeq int64, newToken string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	h.sweepLocked(now)
+	h.clients[c] = true
+
+	s, ok := h.sessions[token]
+	expired := ok && s.client == nil && now.Sub(s.detachedAt) >= wsResumeWindow
+	if !ok || expired || token == "" || s.caller != c.caller {
+		s = &wsSession{token: newToken, caller: c.caller, subscriptions: map[string]bool{}}
+		h.sessions[newToken] = s
+		s.client = c
+		c.session = s
+		c.reply(wsMessage{Type: "session", ResumeToken: s.token, Seq: h.seq})
+		return false
+	}
+
+	// The old connection may not have noticed it is dead yet
+	if s.client != nil {
+		s.client.conn.Close()
+	}
+	s.client = c
+	c.session = s
+
+	overflowed := s.evictedSeq > lastSeq
+	c.reply(wsMessage{Type: "session", ResumeToken: s.token, Seq: h.seq, Resumed: true, Overflowed: overflowed})
+	if !overflowed {
+		for _, e := range s.events {
+			if e.seq > lastSeq {
+				c.send <- e.msg // Fits: wsResumeBuffer leaves room in the queue
+			}
+		}
+	}
+	return true
+}
+
+// sweepLocked drops sessions disconnected for longer than wsResumeWindow, at
+// most once a minute. Callers must hold h.mu.
+func (h *wsHub) sweepLocked(now time.Time) {
+	if now.Sub(h.lastSweep) < time.Minute {
+		return
+	}
+	h.lastSweep = now
+
+	for token, s := range h.sessions {
+		if s.client != nil || now.Sub(s.detachedAt) < wsResumeWindow {
+			continue
+		}
+		for email := range s.subscriptions {
+			delete(h.subs[email], s)
+			if len(h.subs[email]) == 0 {
+				delete(h.subs, email)
+			}
+		}
+		delete(h.sessions, token)
+	}
+}
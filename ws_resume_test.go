@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// FuzzResumeCursor reconnects with arbitrary resume_token and last_seq values
+// against a session whose oldest events have been evicted.
+func FuzzResumeCursor(f *testing.F) {
+	const token = "0123456789abcdef0123456789abcdef"
+	const evicted = 10 // Events recorded beyond what the buffer holds
+
+	f.Add(token, int64(0))
+	f.Add(token, int64(evicted))
+	f.Add(token, int64(evicted+wsResumeBuffer))
+	f.Add(token, int64(-1))
+	f.Add(token, int64(1<<62))
+	f.Add("", int64(evicted))
+	f.Add("not-a-token", int64(evicted))
+
+	f.Fuzz(func(t *testing.T, resumeToken string, lastSeq int64) {
+		caller := Caller{Role: RoleSupplier, Email: "s@b.co"}
+		h := &wsHub{
+			clients:  map[*wsClient]bool{},
+			sessions: map[string]*wsSession{},
+			subs:     map[string]map[*wsSession]bool{},
+			threads:  map[int]map[*wsClient]bool{},
+		}
+		s := &wsSession{token: token, caller: caller, subscriptions: map[string]bool{}, detachedAt: time.Now()}
+		for seq := int64(1); seq <= evicted+wsResumeBuffer; seq++ {
+			s.record(seq, []byte(`{"seq":`+strconv.FormatInt(seq, 10)+`}`))
+		}
+		h.sessions[token] = s
+		h.seq = evicted + wsResumeBuffer
+
+		c := &wsClient{caller: caller, send: make(chan []byte, wsSendQueueSize)}
+		resumed := h.connect(c, resumeToken, lastSeq, "fresh")
+
+		if want := resumeToken == token; resumed != want {
+			t.Fatalf("resumed = %v for token %q, want %v", resumed, resumeToken, want)
+		}
+		if c.session == nil || c.session.client != c {
+			t.Fatal("connection was not attached to a session")
+		}
+
+		var hello wsMessage
+		if err := json.Unmarshal(<-c.send, &hello); err != nil || hello.Type != "session" {
+			t.Fatalf("first message %+v (err %v), want a session message", hello, err)
+		}
+		if hello.Resumed != resumed {
+			t.Fatalf("session message says resumed = %v, want %v", hello.Resumed, resumed)
+		}
+
+		want := 0
+		if resumed && lastSeq >= evicted {
+			for _, e := range s.events {
+				if e.seq > lastSeq {
+					want++
+				}
+			}
+		}
+		if hello.Overflowed != (resumed && lastSeq < evicted) {
+			t.Fatalf("overflowed = %v for last_seq %d, with seq %d evicted", hello.Overflowed, lastSeq, evicted)
+		}
+		if got := len(c.send); got != want {
+			t.Fatalf("replayed %d events after last_seq %d, want %d", got, lastSeq, want)
+		}
+	})
+}